@@ -0,0 +1,196 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// the health service stays open to the probes
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+// Permissions are the rights of a client
+type Permissions struct {
+	// Layers are the layers the client may draw on and clear. Nil allows
+	// all the layers.
+	Layers []uint32
+	// Global allows the requests affecting the whole display: Init,
+	// SetBrightness, SetScene and saving the scene.
+	Global bool
+}
+
+// FullPermissions allows everything
+var FullPermissions = Permissions{Global: true}
+
+// Client is an authenticated client
+type Client struct {
+	Name        string
+	Permissions Permissions
+}
+
+// Auth authenticates the clients by bearer token or by TLS client
+// certificate. Client certificates are only available if the server uses
+// TLS credentials requesting and verifying them.
+type Auth struct {
+	// Tokens maps the bearer tokens (sent in the "authorization" metadata
+	// as "Bearer <token>") to the clients
+	Tokens map[string]Client
+	// Certificates maps the common names of the verified client
+	// certificates to the clients
+	Certificates map[string]Client
+	// Anonymous are the permissions of the clients without credentials.
+	// They are rejected if it is nil.
+	Anonymous *Permissions
+}
+
+type clientKey struct{}
+
+// ClientFromContext returns the client authenticated for a request
+func ClientFromContext(ctx context.Context) (*Client, bool) {
+	client, ok := ctx.Value(clientKey{}).(*Client)
+	return client, ok
+}
+
+// permissionsFrom returns the permissions of the client of a request. It
+// returns nil, allowing everything, if the server has no authentication.
+func permissionsFrom(ctx context.Context) *Permissions {
+	if client, ok := ClientFromContext(ctx); ok {
+		return &client.Permissions
+	}
+	return nil
+}
+
+func (p *Permissions) allowsLayer(layer uint32) bool {
+	if p == nil || p.Layers == nil {
+		return true
+	}
+	for _, l := range p.Layers {
+		if l == layer {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Permissions) allowsGlobal() bool {
+	return p == nil || p.Global
+}
+
+// checkGlobal returns a PermissionDenied status if the client of ctx may
+// not affect the whole display
+func checkGlobal(ctx context.Context, request string) error {
+	if !permissionsFrom(ctx).allowsGlobal() {
+		return permissionDenied("%s not allowed", request)
+	}
+	return nil
+}
+
+// authenticate returns the client sending the request
+func (auth *Auth) authenticate(ctx context.Context) (*Client, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			const prefix = "bearer "
+			if len(value) < len(prefix) || !strings.EqualFold(value[:len(prefix)], prefix) {
+				continue
+			}
+			token := []byte(value[len(prefix):])
+			for t, client := range auth.Tokens {
+				if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+					c := client
+					return &c, nil
+				}
+			}
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token")
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			for _, chain := range info.State.VerifiedChains {
+				if len(chain) == 0 {
+					continue
+				}
+				if client, ok := auth.Certificates[chain[0].Subject.CommonName]; ok {
+					return &client, nil
+				}
+			}
+		}
+	}
+	if auth.Anonymous != nil {
+		return &Client{Name: "anonymous", Permissions: *auth.Anonymous}, nil
+	}
+	return nil, status.Errorf(codes.Unauthenticated, "missing credentials")
+}
+
+// UnaryInterceptor returns an interceptor authenticating the unary
+// requests
+func (auth *Auth) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(ctx, req)
+		}
+		client, err := auth.authenticate(ctx)
+		if err != nil {
+			log.Debugf("Rejected %v: %v", info.FullMethod, err)
+			return nil, err
+		}
+		return handler(context.WithValue(ctx, clientKey{}, client), req)
+	}
+}
+
+// authenticatedStream is a server stream carrying the authenticated
+// client in its context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamInterceptor returns an interceptor authenticating the streams
+func (auth *Auth) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(srv, ss)
+		}
+		client, err := auth.authenticate(ss.Context())
+		if err != nil {
+			log.Debugf("Rejected %v: %v", info.FullMethod, err)
+			return err
+		}
+		ctx := context.WithValue(ss.Context(), clientKey{}, client)
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// ServerOptions returns the options installing the interceptors in a
+// grpc server
+func (auth *Auth) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(auth.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(auth.StreamInterceptor()),
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+	pb "github.com/telecom-tower/towerapi/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// withToken returns a context carrying an authorization metadata
+func withToken(ctx context.Context, authorization string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+}
+
+// withCertificate returns a context of a peer with a verified client
+// certificate
+func withCertificate(ctx context.Context, cn string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	info := credentials.TLSInfo{State: tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{cert}},
+	}}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: info})
+}
+
+// withClient returns a context authenticated with the given permissions
+func withClient(permissions Permissions) context.Context {
+	return context.WithValue(context.Background(), clientKey{}, &Client{Name: "test", Permissions: permissions})
+}
+
+func testAuth(anonymous *Permissions) *Auth {
+	return &Auth{
+		Tokens: map[string]Client{
+			"secret": {Name: "admin", Permissions: FullPermissions},
+		},
+		Certificates: map[string]Client{
+			"display": {Name: "display", Permissions: Permissions{Layers: []uint32{1}}},
+		},
+		Anonymous: anonymous,
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	background := context.Background()
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		anonymous *Permissions
+		client    string // empty if rejected
+	}{
+		{"valid token", withToken(background, "Bearer secret"), nil, "admin"},
+		{"case of the scheme", withToken(background, "bearer secret"), nil, "admin"},
+		{"wrong token", withToken(background, "Bearer wrong"), nil, ""},
+		{"wrong token with anonymous access", withToken(background, "Bearer wrong"), &Permissions{}, ""},
+		{"missing token", background, nil, ""},
+		{"missing token with anonymous access", background, &Permissions{}, "anonymous"},
+		{"other scheme", withToken(background, "Basic secret"), &Permissions{}, "anonymous"},
+		{"client certificate", withCertificate(background, "display"), nil, "display"},
+		{"unknown certificate", withCertificate(background, "other"), nil, ""},
+		{"token before certificate", withToken(withCertificate(background, "display"), "Bearer secret"), nil, "admin"},
+	}
+	for _, tt := range tests {
+		client, err := testAuth(tt.anonymous).authenticate(tt.ctx)
+		if tt.client == "" {
+			if code := status.Code(err); code != codes.Unauthenticated {
+				t.Errorf("%s: code %v, want %v", tt.name, code, codes.Unauthenticated)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if client.Name != tt.client {
+			t.Errorf("%s: client %q, want %q", tt.name, client.Name, tt.client)
+		}
+	}
+}
+
+func TestCertificatePermissions(t *testing.T) {
+	client, err := testAuth(nil).authenticate(withCertificate(context.Background(), "display"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &client.Permissions
+	if !p.allowsLayer(1) || p.allowsLayer(0) || p.allowsGlobal() {
+		t.Errorf("permissions %+v", *p)
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	tests := []struct {
+		method string
+		ctx    context.Context
+		code   codes.Code
+		client string
+	}{
+		{"/grpc.health.v1.Health/Check", context.Background(), codes.OK, ""},
+		{"/grpc.health.v1.Health/Watch", context.Background(), codes.OK, ""},
+		{"/telecomtower.renderer.v1.TowerControl/GetState", context.Background(), codes.Unauthenticated, ""},
+		{"/telecomtower.renderer.v1.TowerControl/GetState", withToken(context.Background(), "Bearer secret"), codes.OK, "admin"},
+	}
+	auth := testAuth(nil)
+	unary := auth.UnaryInterceptor()
+	stream := auth.StreamInterceptor()
+	for _, tt := range tests {
+		var client string
+		check := func(ctx context.Context) {
+			if c, ok := ClientFromContext(ctx); ok {
+				client = c.Name
+			}
+		}
+		_, err := unary(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				check(ctx)
+				return nil, nil
+			})
+		if code := status.Code(err); code != tt.code || client != tt.client {
+			t.Errorf("unary %s: code %v, client %q, want %v, %q", tt.method, code, client, tt.code, tt.client)
+		}
+
+		client = ""
+		err = stream(nil, &fakeDrawStream{ctx: tt.ctx}, &grpc.StreamServerInfo{FullMethod: tt.method},
+			func(srv interface{}, ss grpc.ServerStream) error {
+				check(ss.Context())
+				return nil
+			})
+		if code := status.Code(err); code != tt.code || client != tt.client {
+			t.Errorf("stream %s: code %v, client %q, want %v, %q", tt.method, code, client, tt.code, tt.client)
+		}
+	}
+}
+
+func TestLayerPermissions(t *testing.T) {
+	tower, stop := newTestRenderer()
+	defer stop()
+	ctx := withClient(Permissions{Layers: []uint32{1}})
+	tests := []struct {
+		layer uint32
+		code  codes.Code
+	}{
+		{0, codes.PermissionDenied},
+		{1, codes.OK},
+		{2, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		requests := map[string]*pb.DrawRequest{
+			"rectangle": rectangle(tt.layer, 0, 1, 0xff),
+			"clear":     {Type: &pb.DrawRequest_Clear{Clear: &pb.Clear{Layer: []uint32{tt.layer}}}},
+			"autoroll":  {Type: &pb.DrawRequest_AutoRoll{AutoRoll: &pb.AutoRoll{Layer: tt.layer}}},
+		}
+		for name, req := range requests {
+			err := tower.Draw(&fakeDrawStream{ctx: ctx, requests: []*pb.DrawRequest{req}})
+			if code := status.Code(err); code != tt.code {
+				t.Errorf("Draw %s on layer %d: code %v, want %v", name, tt.layer, code, tt.code)
+			}
+		}
+		_, err := tower.SetRolling(ctx, &api.SetRollingRequest{Layer: tt.layer})
+		if code := status.Code(err); code != tt.code {
+			t.Errorf("SetRolling on layer %d: code %v, want %v", tt.layer, code, tt.code)
+		}
+	}
+}
+
+func TestGlobalPermissions(t *testing.T) {
+	tower, stop := newTestRenderer()
+	defer stop()
+	tower.config.Scene = filepath.Join(t.TempDir(), "scene.json")
+	scene, err := json.Marshal(&Scene{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{"Init", func(ctx context.Context) error {
+			return tower.Draw(&fakeDrawStream{ctx: ctx, requests: []*pb.DrawRequest{
+				{Type: &pb.DrawRequest_Init{Init: &pb.Init{}}},
+			}})
+		}},
+		{"SetBrightness", func(ctx context.Context) error {
+			_, err := (towerControl{tower}).SetBrightness(ctx, &api.SetBrightnessRequest{Brightness: 0x80})
+			return err
+		}},
+		{"SetScene", func(ctx context.Context) error {
+			_, err := tower.SetScene(ctx, &api.Scene{Data: scene})
+			return err
+		}},
+		{"GetScene with persist", func(ctx context.Context) error {
+			_, err := tower.GetScene(ctx, &api.GetSceneRequest{Persist: true})
+			return err
+		}},
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"layers only", withClient(Permissions{Layers: []uint32{0, 1, 2, 3}}), codes.PermissionDenied},
+		{"all layers", withClient(Permissions{}), codes.PermissionDenied},
+		{"global", withClient(Permissions{Global: true}), codes.OK},
+		{"no authentication", context.Background(), codes.OK},
+	}
+	for _, tt := range tests {
+		for _, req := range requests {
+			if code := status.Code(req.call(tt.ctx)); code != tt.code {
+				t.Errorf("%s, %s: code %v, want %v", tt.name, req.name, code, tt.code)
+			}
+		}
+		// reading the scene needs no global permission
+		if _, err := tower.GetScene(tt.ctx, &api.GetSceneRequest{}); err != nil {
+			t.Errorf("%s, GetScene: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// frameClock paces the animation of the display at a fixed frame rate
+type frameClock struct {
+	period     time.Duration
+	maxCatchUp int
+	ticker     *time.Ticker
+	last       time.Time // time of the last frame
+	dropped    uint64    // total number of dropped frames
+}
+
+func newFrameClock(rate int, maxCatchUp int) *frameClock {
+	period := time.Second / time.Duration(rate)
+	return &frameClock{
+		period:     period,
+		maxCatchUp: maxCatchUp,
+		ticker:     time.NewTicker(period),
+		last:       time.Now(),
+	}
+}
+
+// reset restarts the clock at t
+func (fc *frameClock) reset(t time.Time) {
+	fc.last = t
+}
+
+// frames returns the number of frames elapsed between the last frame and
+// t. If the renderer could not keep up, the result is larger than one and
+// the missing frames are counted as dropped. The result never exceeds
+// maxCatchUp; the remaining frames are skipped.
+func (fc *frameClock) frames(t time.Time) int {
+	n := int((t.Sub(fc.last) + fc.period/2) / fc.period)
+	if n <= 0 {
+		// stale tick
+		return 0
+	}
+	fc.last = fc.last.Add(time.Duration(n) * fc.period)
+	if n > 1 {
+		fc.dropped += uint64(n - 1)
+		log.Debugf("Dropped %d frame(s)", n-1)
+	}
+	if n > fc.maxCatchUp {
+		n = fc.maxCatchUp
+	}
+	return n
+}
+
+func (fc *frameClock) stop() {
+	fc.ticker.Stop()
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrameClockFrames(t *testing.T) {
+	const ms = time.Millisecond
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := &frameClock{period: 10 * ms, maxCatchUp: 3, last: start}
+	tests := []struct {
+		name    string
+		tick    time.Duration // time of the tick since the start
+		frames  int
+		dropped uint64
+		last    time.Duration // time of the last frame since the start
+	}{
+		{name: "on time", tick: 10 * ms, frames: 1, dropped: 0, last: 10 * ms},
+		{name: "stale tick", tick: 14 * ms, frames: 0, dropped: 0, last: 10 * ms},
+		{name: "late tick", tick: 24 * ms, frames: 1, dropped: 0, last: 20 * ms},
+		{name: "early tick", tick: 26 * ms, frames: 1, dropped: 0, last: 30 * ms},
+		{name: "two dropped frames", tick: 60 * ms, frames: 3, dropped: 2, last: 60 * ms},
+		{name: "catch up capped", tick: 153 * ms, frames: 3, dropped: 10, last: 150 * ms},
+		{name: "on time again", tick: 160 * ms, frames: 1, dropped: 10, last: 160 * ms},
+		{name: "one dropped frame", tick: 181 * ms, frames: 2, dropped: 11, last: 180 * ms},
+	}
+	for _, tt := range tests {
+		if got := fc.frames(start.Add(tt.tick)); got != tt.frames {
+			t.Errorf("%s: frames(%v) = %d, want %d", tt.name, tt.tick, got, tt.frames)
+		}
+		if fc.dropped != tt.dropped {
+			t.Errorf("%s: %d dropped frames, want %d", tt.name, fc.dropped, tt.dropped)
+		}
+		if got := fc.last.Sub(start); got != tt.last {
+			t.Errorf("%s: last frame at %v, want %v", tt.name, got, tt.last)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// tower-simulator runs the telecom tower gRPC server and shows the display
+// in the terminal instead of driving the LEDs.
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	renderer "github.com/telecom-tower/grpc-renderer"
+	"github.com/telecom-tower/grpc-renderer/engine/terminal"
+	"github.com/telecom-tower/grpc-renderer/preview"
+	"github.com/telecom-tower/grpc-renderer/tracing"
+)
+
+func main() {
+	addr := flag.String("addr", ":10000", "listening address")
+	width := flag.Int("width", 128, "width of the display")
+	height := flag.Int("height", 8, "height of the display")
+	layers := flag.Int("layers", 8, "number of layers")
+	fps := flag.Int("fps", 30, "frame rate")
+	scene := flag.String("scene", "", "file of the scene restored at startup")
+	previewAddr := flag.String("preview", "", "address of the browser preview (disabled if empty)")
+	metricsAddr := flag.String("metrics", "", "address of the Prometheus metrics (disabled if empty)")
+	otlpAddr := flag.String("otlp", "", "address of the OpenTelemetry collector (tracing disabled if empty)")
+	reflection := flag.Bool("reflection", false, "enable gRPC server reflection")
+	debug := flag.Bool("debug", false, "enable debug messages")
+	flag.Parse()
+
+	// the display uses stdout, keep the messages on stderr
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	config := renderer.Config{
+		Width:      *width,
+		Height:     *height,
+		Layers:     *layers,
+		FrameRate:  *fps,
+		Scene:      *scene,
+		Reflection: *reflection,
+	}
+	ws := terminal.New(os.Stdout, config)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	if *otlpAddr != "" {
+		shutdown, err := tracing.Start(context.Background(), *otlpAddr, "tower-simulator")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer shutdown(context.Background()) // nolint: errcheck
+	}
+	tower := renderer.NewRenderer(ws, config)
+	if *metricsAddr != "" {
+		go func() {
+			log.Error(tower.ServeMetrics(*metricsAddr))
+		}()
+	}
+	if *previewAddr != "" {
+		go func() {
+			log.Error(preview.ListenAndServe(*previewAddr, tower, *fps))
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	if err := renderer.NewServer(tower).Run(ctx, listener); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image/color"
+	"math"
+)
+
+// ChannelOrder is the order in which the LEDs expect the color components
+type ChannelOrder int
+
+// Supported channel orders
+const (
+	RGB ChannelOrder = iota
+	RBG
+	GRB
+	GBR
+	BRG
+	BGR
+)
+
+// Decode returns the red, green and blue components of a LED value sent
+// in the given order
+func (order ChannelOrder) Decode(c uint32) (r, g, b uint8) {
+	o, ok := channelOrders[order]
+	if !ok {
+		o = channelOrders[RGB]
+	}
+	var rgb [3]uint8
+	rgb[o[0]] = uint8(c >> 16)
+	rgb[o[1]] = uint8(c >> 8)
+	rgb[o[2]] = uint8(c)
+	return rgb[0], rgb[1], rgb[2]
+}
+
+// channel index (R=0, G=1, B=2) sent first, second and third
+var channelOrders = map[ChannelOrder][3]int{
+	RGB: {0, 1, 2},
+	RBG: {0, 2, 1},
+	GRB: {1, 0, 2},
+	GBR: {1, 2, 0},
+	BRG: {2, 0, 1},
+	BGR: {2, 1, 0},
+}
+
+// ColorCorrection describes how the colors of the display are transformed
+// before being sent to the LEDs. The zero value sends the colors unchanged.
+type ColorCorrection struct {
+	// Gamma is the gamma exponent of the red, green and blue channels. A
+	// zero value means linear (1.0).
+	Gamma [3]float64
+	// Matrix is applied to the gamma corrected colors to calibrate the
+	// white point of the LEDs (see WhiteBalance and ColorTemperature). The
+	// zero matrix means identity.
+	Matrix [3][3]float64
+	// Order is the order of the channels expected by the LEDs
+	Order ChannelOrder
+}
+
+// WhiteBalance returns a matrix scaling each channel by the given factor
+func WhiteBalance(r, g, b float64) [3][3]float64 {
+	return [3][3]float64{
+		{r, 0, 0},
+		{0, g, 0},
+		{0, 0, b},
+	}
+}
+
+// ColorTemperature returns a matrix shifting the white of LEDs calibrated
+// at 6500K to the given color temperature (in Kelvin). The approximation
+// of the black body color is the one of Tanner Helland.
+func ColorTemperature(kelvin float64) [3][3]float64 {
+	r, g, b := blackBody(kelvin)
+	r0, g0, b0 := blackBody(6500)
+	return WhiteBalance(r/r0, g/g0, b/b0)
+}
+
+func blackBody(kelvin float64) (float64, float64, float64) {
+	t := kelvin / 100
+	var r, g, b float64
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+	return clamp(r / 255), clamp(g / 255), clamp(b / 255)
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// colorPipeline is the compiled form of a ColorCorrection
+type colorPipeline struct {
+	identity bool
+	linear   [3][256]float64 // gamma tables
+	matrix   [3][3]float64
+	order    [3]int
+}
+
+func newColorPipeline(cc ColorCorrection) *colorPipeline {
+	p := &colorPipeline{
+		matrix: cc.Matrix,
+		order:  channelOrders[RGB],
+	}
+	if order, ok := channelOrders[cc.Order]; ok {
+		p.order = order
+	}
+	if p.matrix == ([3][3]float64{}) {
+		p.matrix = WhiteBalance(1, 1, 1)
+	}
+	p.identity = cc.Order == RGB && p.matrix == WhiteBalance(1, 1, 1)
+	for c := 0; c < 3; c++ {
+		gamma := cc.Gamma[c]
+		if gamma <= 0 {
+			gamma = 1
+		}
+		if gamma != 1 {
+			p.identity = false
+		}
+		for i := 0; i < 256; i++ {
+			p.linear[c][i] = math.Pow(float64(i)/255, gamma)
+		}
+	}
+	return p
+}
+
+// pack converts a color to the 24 bits value sent to a LED
+func (p *colorPipeline) pack(c color.Color) uint32 {
+	r, g, b, _ := c.RGBA()
+	if p.identity {
+		return ((r>>8)&0xff)<<16 + ((g>>8)&0xff)<<8 + ((b>>8)&0xff)<<0
+	}
+	in := [3]float64{
+		p.linear[0][(r>>8)&0xff],
+		p.linear[1][(g>>8)&0xff],
+		p.linear[2][(b>>8)&0xff],
+	}
+	var out [3]uint32
+	for i := 0; i < 3; i++ {
+		v := p.matrix[i][0]*in[0] + p.matrix[i][1]*in[1] + p.matrix[i][2]*in[2]
+		out[i] = uint32(math.Round(clamp(v) * 255))
+	}
+	return out[p.order[0]]<<16 + out[p.order[1]]<<8 + out[p.order[2]]<<0
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestColorPipelineIdentity(t *testing.T) {
+	tests := []ColorCorrection{
+		{},
+		{Gamma: [3]float64{1, 1, 1}, Matrix: WhiteBalance(1, 1, 1)},
+	}
+	for _, cc := range tests {
+		p := newColorPipeline(cc)
+		if !p.identity {
+			t.Errorf("%+v: not identity", cc)
+		}
+		for _, c := range []color.RGBA{{0, 0, 0, 0xff}, {0x12, 0x34, 0x56, 0xff}, {0xff, 0xff, 0xff, 0xff}} {
+			want := uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+			if v := p.pack(c); v != want {
+				t.Errorf("%+v: pack(%v) = %#06x, want %#06x", cc, c, v, want)
+			}
+		}
+	}
+}
+
+func TestColorPipelineGamma(t *testing.T) {
+	p := newColorPipeline(ColorCorrection{Gamma: [3]float64{2.2, 1, 2.8}})
+	if p.identity {
+		t.Fatal("gamma pipeline is identity")
+	}
+	tests := []struct {
+		in   uint8
+		want [3]uint32
+	}{
+		{0, [3]uint32{0, 0, 0}},
+		{0xff, [3]uint32{0xff, 0xff, 0xff}},
+		{0x80, [3]uint32{
+			uint32(math.Round(math.Pow(128.0/255, 2.2) * 255)),
+			0x80,
+			uint32(math.Round(math.Pow(128.0/255, 2.8) * 255)),
+		}},
+	}
+	for _, tt := range tests {
+		v := p.pack(color.RGBA{tt.in, tt.in, tt.in, 0xff})
+		got := [3]uint32{v >> 16 & 0xff, v >> 8 & 0xff, v & 0xff}
+		if got != tt.want {
+			t.Errorf("pack(%#x) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestColorPipelineWhiteBalance(t *testing.T) {
+	p := newColorPipeline(ColorCorrection{Matrix: WhiteBalance(1, 0.5, 2)})
+	if v := p.pack(color.RGBA{0x80, 0x80, 0x80, 0xff}); v != 0x8040ff {
+		t.Errorf("pack = %#06x, want 0x8040ff", v)
+	}
+}
+
+func TestChannelOrderRoundTrip(t *testing.T) {
+	c := color.RGBA{0x12, 0x34, 0x56, 0xff}
+	tests := []struct {
+		order ChannelOrder
+		want  uint32
+	}{
+		{RGB, 0x123456},
+		{RBG, 0x125634},
+		{GRB, 0x341256},
+		{GBR, 0x345612},
+		{BRG, 0x561234},
+		{BGR, 0x563412},
+	}
+	for _, tt := range tests {
+		p := newColorPipeline(ColorCorrection{Order: tt.order})
+		v := p.pack(c)
+		if v != tt.want {
+			t.Errorf("order %d: pack = %#06x, want %#06x", tt.order, v, tt.want)
+		}
+		if r, g, b := tt.order.Decode(v); r != c.R || g != c.G || b != c.B {
+			t.Errorf("order %d: Decode(%#06x) = %#x %#x %#x", tt.order, v, r, g, b)
+		}
+	}
+}
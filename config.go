@@ -0,0 +1,131 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+)
+
+const (
+	defaultDisplayHeight = 8
+	defaultDisplayWidth  = 128
+	defaultMaxLayers     = 8
+	defaultFrameRate     = 30
+	defaultMaxCatchUp    = 5
+)
+
+// Config describes the display driven by a TowerRenderer
+type Config struct {
+	// Width and Height are the size of the display in pixels
+	Width  int
+	Height int
+	// Layers is the number of layers available to the clients
+	Layers int
+	// Mapper maps the pixels of the display to the LEDs. The default is the
+	// wiring of the telecom tower: columns, serpentine, starting top left.
+	Mapper PixelMapper
+	// Segments splits the display over several channels or engines. By
+	// default, the whole display is sent to channel 0 of the engine using
+	// Mapper.
+	Segments []Segment
+	// FrameRate is the number of frames per second while animating
+	FrameRate int
+	// MaxCatchUp is the maximum number of frames the animation advances at
+	// once when the renderer is late. Later frames are dropped.
+	MaxCatchUp int
+	// Color is the color correction applied before sending the colors to
+	// the LEDs
+	Color ColorCorrection
+	// Brightness is the initial global brightness (1-255, default 255)
+	Brightness int
+	// Power is the power budget of the LEDs
+	Power PowerBudget
+	// Recovery defines how the renderer recovers when the engines fail
+	Recovery RecoveryPolicy
+	// Auth authenticates the clients and restricts what they may draw. Nil
+	// disables authentication.
+	Auth *Auth
+	// Reflection enables the gRPC server reflection service
+	Reflection bool
+	// Scene is the file of the scene restored by Serve before accepting
+	// connections and saved by the GetScene RPC on request. Empty
+	// disables it.
+	Scene string
+}
+
+// DefaultConfig returns the configuration of the original telecom tower
+// (128x8 pixels and 8 layers)
+func DefaultConfig() Config {
+	return Config{
+		Width:      defaultDisplayWidth,
+		Height:     defaultDisplayHeight,
+		Layers:     defaultMaxLayers,
+		FrameRate:  defaultFrameRate,
+		MaxCatchUp: defaultMaxCatchUp,
+	}
+}
+
+// normalized returns a copy of the configuration where all unset
+// fields are replaced by their default value
+func (c Config) normalized() Config {
+	if c.Width <= 0 {
+		c.Width = defaultDisplayWidth
+	}
+	if c.Height <= 0 {
+		c.Height = defaultDisplayHeight
+	}
+	if c.Layers <= 0 {
+		c.Layers = defaultMaxLayers
+	}
+	if c.FrameRate <= 0 {
+		c.FrameRate = defaultFrameRate
+	}
+	if c.MaxCatchUp <= 0 {
+		c.MaxCatchUp = defaultMaxCatchUp
+	}
+	if c.Brightness <= 0 || c.Brightness > defaultBrightness {
+		c.Brightness = defaultBrightness
+	}
+	if c.Power.MilliampsPerChannel <= 0 {
+		c.Power.MilliampsPerChannel = defaultMilliampsPerChannel
+	}
+	if c.Recovery.MinBackoff <= 0 {
+		c.Recovery.MinBackoff = defaultMinBackoff
+	}
+	if c.Recovery.MaxBackoff <= 0 {
+		c.Recovery.MaxBackoff = defaultMaxBackoff
+	}
+	if c.Recovery.MaxBackoff < c.Recovery.MinBackoff {
+		c.Recovery.MaxBackoff = c.Recovery.MinBackoff
+	}
+	if c.Recovery.ReinitAfter == 0 {
+		c.Recovery.ReinitAfter = defaultReinitAfter
+	}
+	if c.Mapper == nil {
+		c.Mapper = &MatrixMapper{
+			Width:      c.Width,
+			Height:     c.Height,
+			Serpentine: true,
+			Origin:     TopLeft,
+		}
+	}
+	if len(c.Segments) == 0 {
+		c.Segments = []Segment{{
+			Bounds: image.Rect(0, 0, c.Width, c.Height),
+			Mapper: c.Mapper,
+		}}
+	}
+	return c
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+	"golang.org/x/net/context"
+)
+
+// towerControl serves the TowerControl service for a renderer. It only
+// exists because the SetBrightness RPC clashes with the SetBrightness
+// method of TowerRenderer.
+type towerControl struct {
+	*TowerRenderer
+}
+
+// SetRolling sets the speed, the direction and the pauses of a rolling
+// layer. The change is committed at once, like a Draw stream with a single
+// request.
+func (tower *TowerRenderer) SetRolling(ctx context.Context, req *api.SetRollingRequest) (*api.SetRollingResponse, error) {
+	log.Debugf("Set rolling (layer: %v, speed: %v, direction: %v, pause: %vms)",
+		req.Layer, req.Speed, req.Direction, req.PauseMs)
+	session := tower.newSession(ctx)
+	if err := session.checkLayer(req.Layer); err != nil {
+		return nil, err
+	}
+	if err := checkRollingDirection(int(req.Direction)); err != nil {
+		return nil, err
+	}
+	if req.Speed < 0 {
+		return nil, invalidArgument("negative rolling speed %v", req.Speed)
+	}
+	layer := session.layer(req.Layer)
+	layer.rolling.direction = int(req.Direction)
+	layer.rolling.speed = float64(req.Speed)
+	layer.rolling.pause = time.Duration(req.PauseMs) * time.Millisecond
+	layer.rolling.lineHeight = int(req.LineHeight)
+	tower.commit(ctx, session)
+	return &api.SetRollingResponse{}, nil
+}
+
+// SetBrightness changes the global brightness of the display and displays
+// the current frame again
+func (tc towerControl) SetBrightness(ctx context.Context, req *api.SetBrightnessRequest) (*api.SetBrightnessResponse, error) {
+	log.Debugf("Set Brightness (%v)", req.Brightness)
+	if err := checkGlobal(ctx, "brightness"); err != nil {
+		return nil, err
+	}
+	if req.Brightness > 0xff {
+		return nil, outOfRange("brightness %d out of range [0, 255]", req.Brightness)
+	}
+	tower := tc.TowerRenderer
+	tower.mu.Lock()
+	defer tower.mu.Unlock()
+	tower.SetBrightness(uint8(req.Brightness))
+	tower.refresh(ctx)
+	return &api.SetBrightnessResponse{}, nil
+}
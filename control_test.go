@@ -0,0 +1,137 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+	"github.com/telecom-tower/sdk"
+	pb "github.com/telecom-tower/towerapi/v1"
+	"golang.org/x/net/context"
+)
+
+// ledsEngine sends a copy of the LEDs of channel 0 on each SetLedsSync
+type ledsEngine struct {
+	leds chan []uint32
+}
+
+func (e *ledsEngine) Init() error   { return nil }
+func (e *ledsEngine) Fini()         {}
+func (e *ledsEngine) Render() error { return nil }
+func (e *ledsEngine) Wait() error   { return nil }
+
+func (e *ledsEngine) SetLedsSync(channel int, leds []uint32) error {
+	select {
+	case e.leds <- append([]uint32(nil), leds...):
+	default:
+	}
+	return nil
+}
+
+// nextLeds returns the first LEDs received which differ from previous
+func nextLeds(t *testing.T, e *ledsEngine, previous []uint32) []uint32 {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case leds := <-e.leds:
+			if !equalLeds(leds, previous) {
+				return leds
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for new LEDs")
+		}
+	}
+}
+
+func equalLeds(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSetBrightnessKeepsRollingLayers(t *testing.T) {
+	engine := &ledsEngine{leds: make(chan []uint32, 1000)}
+	tower := NewRenderer(engine, Config{Width: 4, Height: 1, Layers: 1, FrameRate: 100})
+	lsc := tower.loop()
+	tower.mu.Lock()
+	tower.lsc = lsc
+	tower.mu.Unlock()
+	defer tower.stop()
+	ctx := context.Background()
+
+	// a layer of 8 gray columns rolling at 5 pixels per second: its
+	// position changes every 20 frames
+	if _, err := tower.SetRolling(ctx, &api.SetRollingRequest{Speed: 5}); err != nil {
+		t.Fatal(err)
+	}
+	var requests []*pb.DrawRequest
+	for x := int32(0); x < 8; x++ {
+		requests = append(requests, rectangle(0, x, x+1, uint32(0x10*(x+1))))
+	}
+	requests = append(requests, &pb.DrawRequest{Type: &pb.DrawRequest_AutoRoll{
+		AutoRoll: &pb.AutoRoll{Mode: sdk.RollingStart},
+	}})
+	if err := tower.Draw(&fakeDrawStream{requests: requests}); err != nil {
+		t.Fatal(err)
+	}
+
+	// wait until the layer has moved, it then stays still for 200ms
+	start := nextLeds(t, engine, make([]uint32, 4))
+	moved := nextLeds(t, engine, start)
+
+	if _, err := (towerControl{tower}).SetBrightness(ctx, &api.SetBrightnessRequest{Brightness: 0x80}); err != nil {
+		t.Fatal(err)
+	}
+	want := make([]uint32, len(moved))
+	for i, c := range moved {
+		v := uint32(float64(c&0xff) * 0x80 / 0xff)
+		want[i] = v<<16 | v<<8 | v
+	}
+	if got := nextLeds(t, engine, moved); !equalLeds(got, want) {
+		t.Errorf("LEDs after SetBrightness = %x, want %x (LEDs before %x, at the start %x)",
+			got, want, moved, start)
+	}
+}
+
+func TestSetBrightnessRange(t *testing.T) {
+	tower, stop := newTestRenderer()
+	defer stop()
+	tests := []struct {
+		brightness uint32
+		wantErr    bool
+	}{
+		{0, false},
+		{0xff, false},
+		{0x100, true},
+	}
+	for _, tt := range tests {
+		_, err := (towerControl{tower}).SetBrightness(context.Background(), &api.SetBrightnessRequest{Brightness: tt.brightness})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("brightness %d: error %v, want error %v", tt.brightness, err, tt.wantErr)
+		}
+		if err == nil && uint32(tower.Brightness()) != tt.brightness {
+			t.Errorf("brightness %d: Brightness() = %d", tt.brightness, tower.Brightness())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"image/color"
+)
+
+// FrameDecoder rebuilds the image of the display from the LED buffers
+// received by an engine. It inverts the mapping done by the renderer and
+// is meant for engines simulating or recording the display.
+type FrameDecoder struct {
+	bounds    image.Rectangle
+	positions map[int][]image.Point
+	order     ChannelOrder
+}
+
+// NewFrameDecoder returns a decoder for the LEDs sent to the engine ws by
+// a renderer using the given configuration
+func NewFrameDecoder(config Config, ws WsEngine) *FrameDecoder {
+	config = config.normalized()
+	return &FrameDecoder{
+		bounds:    image.Rect(0, 0, config.Width, config.Height),
+		positions: config.ledPositions(ws),
+		order:     config.Color.Order,
+	}
+}
+
+// Bounds returns the bounds of the display
+func (d *FrameDecoder) Bounds() image.Rectangle {
+	return d.bounds
+}
+
+// Decode draws the LEDs of a channel on img
+func (d *FrameDecoder) Decode(img *image.RGBA, channel int, leds []uint32) {
+	positions := d.positions[channel]
+	for i, c := range leds {
+		if i >= len(positions) {
+			break
+		}
+		p := positions[i]
+		if p.X < 0 {
+			continue
+		}
+		r, g, b := d.order.Decode(c)
+		img.Set(p.X, p.Y, color.RGBA{R: r, G: g, B: b, A: 0xff})
+	}
+}
@@ -2,14 +2,21 @@ package renderer
 
 import (
 	"image"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/telecom-tower/sdk"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
 )
 
+var errFrameNotDisplayed = errors.New("frame not displayed")
+
 func (tower *TowerRenderer) renderLed(ls layersSet) error {
-	// t0 := time.Now()
+	t0 := time.Now()
+	displayWidth, displayHeight := tower.config.Width, tower.config.Height
 	result := image.NewRGBA(image.Rect(0, 0, displayWidth, displayHeight))
 	for _, layer := range ls {
 		// log.Debugf("Render LEDS using origin %v", layer.origin)
@@ -20,55 +27,107 @@ func (tower *TowerRenderer) renderLed(ls layersSet) error {
 			}
 		}
 	}
-	leds := make([]uint32, displayHeight*displayWidth)
-	for x := 0; x < displayWidth; x++ {
-		for y := 0; y < displayHeight; y++ {
-			var index int
-			if x%2 == 0 {
-				index = x*displayHeight + y
-			} else {
-				index = x*displayHeight + (displayHeight - 1 - y)
+	tower.frames.publish(result)
+	for _, out := range tower.outputs {
+		out.leds = make([]uint32, out.length)
+	}
+	for _, seg := range tower.segments {
+		bounds := seg.Bounds.Intersect(result.Bounds())
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				index := seg.Mapper.Index(x-seg.Bounds.Min.X, y-seg.Bounds.Min.Y)
+				if index < 0 || index >= seg.Mapper.Len() {
+					continue
+				}
+				seg.out.leds[seg.Offset+index] = tower.colors.pack(result.At(x, y))
 			}
-			r, g, b, _ := result.At(x, y).RGBA()
-			c := ((r>>8)&0xff)<<16 + ((g>>8)&0xff)<<8 + ((b>>8)&0xff)<<0
-			leds[index] = c
 		}
 	}
-	if err := tower.ws.SetLedsSync(0, leds); err != nil {
-		return errors.WithMessage(err, "Error rendering frame")
+	tower.dim(tower.outputs)
+	tower.metrics.composition.Observe(time.Since(t0).Seconds())
+	for _, out := range tower.outputs {
+		t1 := time.Now()
+		if err := out.engine.SetLedsSync(out.channel, out.leds); err != nil {
+			return errors.WithMessage(err, "Error rendering frame")
+		}
+		tower.metrics.setLeds.Observe(time.Since(t1).Seconds())
 	}
-	// log.Debugf("Rendering time: %f µs", time.Since(t0).Seconds()*1e6)
-	return tower.ws.Render()
+	for _, engine := range tower.engines {
+		if err := engine.Render(); err != nil {
+			return err
+		}
+	}
+	tower.metrics.frames.Inc()
+	return nil
 }
 
 // This function is rather complex. I should perhaps refactor it
-func (tower *TowerRenderer) loop() chan layersSet { // nolint: gocyclo
+func (tower *TowerRenderer) loop() chan layersUpdate { // nolint: gocyclo
 	log.Debug("Starting tower loop")
-	c := make(chan layersSet)
+	c := make(chan layersUpdate)
 
-	rollingLayers := make([]rollingLayer, maxLayers)
-	for i := 0; i < maxLayers; i++ {
+	rollingLayers := make([]rollingLayer, tower.config.Layers)
+	for i := 0; i < tower.config.Layers; i++ {
 		rollingLayers[i].queue = make(layersSet, 0)
+		rollingLayers[i].displayWidth = tower.config.Width
+		rollingLayers[i].displayHeight = tower.config.Height
+		rollingLayers[i].frameRate = tower.config.FrameRate
 	}
 	hasRollingLayers := false
+	clock := newFrameClock(tower.config.FrameRate, tower.config.MaxCatchUp)
+	rec := &recovery{policy: tower.config.Recovery}
+	queueGauges := tower.metrics.rollingQueueGauges(tower.config.Layers)
+
+	done := make(chan struct{})
+	tower.loopDone = done
 
 	go func() {
+		defer close(done)
+		defer clock.stop()
 		var currentSet layersSet
+		// trace of the last update, until it is displayed
+		var pending context.Context
 		for {
+			var update layersUpdate
 			var newSet bool
+			// the loop ends when the channel is closed
+			open := true
+			// number of frames the rolling layers have to advance
+			frames := 0
 			if hasRollingLayers {
 				select {
-				case currentSet = <-c:
+				case update, open = <-c:
 					newSet = true
-				default:
-					newSet = false
+				case t := <-clock.ticker.C:
+					dropped := clock.dropped
+					frames = clock.frames(t)
+					tower.metrics.droppedFrames.Add(float64(clock.dropped - dropped))
+					if frames == 0 {
+						continue
+					}
+				case <-rec.retry:
 				}
 			} else {
-				currentSet = <-c
-				newSet = true
+				select {
+				case update, open = <-c:
+					newSet = true
+				case <-rec.retry:
+				}
+				clock.reset(time.Now())
+			}
+			if !open {
+				log.Debug("Stopping tower loop")
+				return
 			}
 
+			if newSet && update.refresh {
+				// same layers, only the brightness changed
+				newSet = false
+				pending = update.ctx
+			}
 			if newSet {
+				currentSet = update.layers
+				pending = update.ctx
 				hasRollingLayers = false
 				log.Debug("Received new set")
 				for _, l := range currentSet {
@@ -81,6 +140,11 @@ func (tower *TowerRenderer) loop() chan layersSet { // nolint: gocyclo
 						rollingLayers[l.id].setPos(0)
 						hasRollingLayers = true
 					case sdk.RollingContinue:
+						// a layer which was not rolling yet starts now
+						if len(rollingLayers[l.id].queue) == 0 {
+							rollingLayers[l.id].enqueue(l)
+							rollingLayers[l.id].setPos(0)
+						}
 						hasRollingLayers = true
 					case sdk.RollingNext:
 						rollingLayers[l.id].enqueue(l)
@@ -96,11 +160,16 @@ func (tower *TowerRenderer) loop() chan layersSet { // nolint: gocyclo
 					case sdk.RollingStart:
 						l.rolling.mode = sdk.RollingContinue
 					case sdk.RollingContinue:
-						rollingLayers[l.id].advance()
+						rollingLayers[l.id].advance(frames)
 					}
 				}
 			}
 
+			for i := range rollingLayers {
+				queueGauges[i].Set(float64(len(rollingLayers[i].queue)))
+			}
+			tower.metrics.activeLayers.Set(float64(len(currentSet)))
+
 			toDisplay := make(layersSet, 0)
 			for _, l := range currentSet {
 				if l.rolling.mode == sdk.RollingContinue {
@@ -110,8 +179,34 @@ func (tower *TowerRenderer) loop() chan layersSet { // nolint: gocyclo
 				}
 			}
 
-			_ = tower.renderLed(toDisplay)
+			if pending == nil || rec.waiting() {
+				tower.display(toDisplay, rec)
+				continue
+			}
+			_, span := tracer.Start(pending, "display", trace.WithAttributes(
+				attribute.Int("layers", len(toDisplay)),
+			))
+			if tower.display(toDisplay, rec) {
+				pending = nil
+				span.End()
+			} else {
+				endSpan(span, errFrameNotDisplayed)
+			}
 		}
 	}()
 	return c
 }
+
+// stop stops the loop and waits for its end. No layers set may be sent
+// to the loop afterwards.
+func (tower *TowerRenderer) stop() {
+	tower.mu.Lock()
+	lsc := tower.lsc
+	tower.lsc = nil
+	tower.mu.Unlock()
+	if lsc == nil {
+		return
+	}
+	close(lsc)
+	<-tower.loopDone
+}
@@ -22,12 +22,15 @@ package renderer
 import (
 	"image"
 	"io"
+	"strings"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/telecom-tower/grpc-renderer/font"
 	"github.com/telecom-tower/sdk"
 	pb "github.com/telecom-tower/towerapi/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func resetLayer(l *layer) {
@@ -38,30 +41,67 @@ func resetLayer(l *layer) {
 	l.rolling.mode = sdk.RollingStop
 	l.rolling.entry = 0
 	l.rolling.separator = 0
+	l.rolling.direction = rollingLeft
+	l.rolling.speed = 0
+	l.rolling.pause = 0
+	l.rolling.lineHeight = 0
 }
 
-func (tower *TowerRenderer) init(clear *pb.Init) error {
+func (session *drawSession) init(clear *pb.Init) error {
 	log.Debugf("init")
-	for l := 0; l < maxLayers; l++ {
-		resetLayer(tower.layers[l])
-		tower.activeLayers[l] = false
+	if !session.permissions.allowsGlobal() {
+		return permissionDenied("init not allowed")
+	}
+	for l := range session.layers {
+		resetLayer(session.layers[l])
+		session.activeLayers[l] = false
 	}
 	return nil
 }
 
-func (tower *TowerRenderer) clear(clear *pb.Clear) error {
+func (session *drawSession) clear(clear *pb.Clear) error {
 	log.Debugf("clear")
 	for _, l := range clear.Layer {
-		resetLayer(tower.layers[l])
-		tower.activeLayers[l] = false
+		if err := session.checkLayer(l); err != nil {
+			return err
+		}
+	}
+	for _, l := range clear.Layer {
+		resetLayer(session.layers[l])
+		session.activeLayers[l] = false
 	}
 	return nil
 }
 
-func (tower *TowerRenderer) setPixels(pixels *pb.SetPixels) error {
+func (session *drawSession) setPixels(pixels *pb.SetPixels) error {
 	log.Debugf("set pixels")
-	tower.activeLayers[pixels.Layer] = true
-	layer := tower.layers[pixels.Layer]
+	if err := session.checkLayer(pixels.Layer); err != nil {
+		return err
+	}
+	if err := checkPaintMode(pixels.PaintMode); err != nil {
+		return err
+	}
+	for _, pix := range pixels.Pixels {
+		if pix == nil {
+			return errMissing("pixel")
+		}
+		if err := checkPoint(pix.Point, "pixel point"); err != nil {
+			return err
+		}
+		if err := checkColor(pix.Color, "pixel color"); err != nil {
+			return err
+		}
+	}
+	var area image.Rectangle
+	for _, pix := range pixels.Pixels {
+		x, y := int(pix.Point.X), int(pix.Point.Y)
+		area = area.Union(image.Rect(x, y, x+1, y+1))
+	}
+	if err := session.checkCanvas(pixels.Layer, area); err != nil {
+		return err
+	}
+	session.activeLayers[pixels.Layer] = true
+	layer := session.layer(pixels.Layer)
 	canvas := layer.image
 	for _, pix := range pixels.Pixels {
 		point := image.Point{
@@ -73,39 +113,80 @@ func (tower *TowerRenderer) setPixels(pixels *pb.SetPixels) error {
 			image.Rect(point.X, point.Y, point.X+1, point.Y+1))
 		paint(canvas, point.X, point.Y, pbColorToColor(pix.Color), int(pixels.PaintMode))
 	}
-	tower.layers[pixels.Layer].image = canvas
+	session.layers[pixels.Layer].image = canvas
 	return nil
 }
 
-func (tower *TowerRenderer) drawRectangle(rect *pb.DrawRectangle) error {
+func (session *drawSession) drawRectangle(rect *pb.DrawRectangle) error {
 	log.Debug("draw rectangle")
-	tower.activeLayers[rect.Layer] = true
-	layer := tower.layers[rect.Layer]
-	layer.dirty = true
+	if err := session.checkLayer(rect.Layer); err != nil {
+		return err
+	}
+	if err := checkPoint(rect.Min, "rectangle min"); err != nil {
+		return err
+	}
+	if err := checkPoint(rect.Max, "rectangle max"); err != nil {
+		return err
+	}
+	if err := checkColor(rect.Color, "rectangle color"); err != nil {
+		return err
+	}
+	if err := checkPaintMode(rect.PaintMode); err != nil {
+		return err
+	}
+	if rect.Min.X > rect.Max.X || rect.Min.Y > rect.Max.Y {
+		return invalidArgument("rectangle min (%d, %d) after max (%d, %d)",
+			rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y)
+	}
+	r := image.Rect(int(rect.Min.X), int(rect.Min.Y), int(rect.Max.X), int(rect.Max.Y))
+	if err := session.checkCanvas(rect.Layer, r); err != nil {
+		return err
+	}
+	session.activeLayers[rect.Layer] = true
+	layer := session.layer(rect.Layer)
 	canvas := layer.image
 	c := pbColorToColor(rect.Color)
-	r := image.Rect(int(rect.Min.X), int(rect.Min.Y), int(rect.Max.X), int(rect.Max.Y))
 	canvas = resizeImage(canvas, r)
 	for x := r.Min.X; x < r.Max.X; x++ {
 		for y := r.Min.Y; y < r.Max.Y; y++ {
 			paint(canvas, x, y, c, int(rect.PaintMode))
 		}
 	}
-	tower.layers[rect.Layer].image = canvas
+	session.layers[rect.Layer].image = canvas
 	return nil
 }
 
-func (tower *TowerRenderer) drawBitmap(bitmap *pb.DrawBitmap) error {
+func (session *drawSession) drawBitmap(bitmap *pb.DrawBitmap) error {
 	log.Debug("draw bitmap")
+	if err := session.checkLayer(bitmap.Layer); err != nil {
+		return err
+	}
+	if err := checkPoint(bitmap.Position, "bitmap position"); err != nil {
+		return err
+	}
+	if err := checkPaintMode(bitmap.PaintMode); err != nil {
+		return err
+	}
+	if n := uint64(bitmap.Width) * uint64(bitmap.Height); uint64(len(bitmap.Colors)) < n {
+		return invalidArgument(
+			"bitmap has %d colors, %dx%d needed", len(bitmap.Colors), bitmap.Width, bitmap.Height)
+	}
+	for _, c := range bitmap.Colors {
+		if err := checkColor(c, "bitmap color"); err != nil {
+			return err
+		}
+	}
 	bounds := image.Rect(
 		int(bitmap.Position.X),
 		int(bitmap.Position.Y),
 		int(bitmap.Position.X)+int(bitmap.Width),
 		int(bitmap.Position.Y)+int(bitmap.Height),
 	)
-	tower.activeLayers[bitmap.Layer] = true
-	layer := tower.layers[bitmap.Layer]
-	layer.dirty = true
+	if err := session.checkCanvas(bitmap.Layer, bounds); err != nil {
+		return err
+	}
+	session.activeLayers[bitmap.Layer] = true
+	layer := session.layer(bitmap.Layer)
 	canvas := layer.image
 	canvas = resizeImage(canvas, bounds)
 	i := 0
@@ -115,18 +196,22 @@ func (tower *TowerRenderer) drawBitmap(bitmap *pb.DrawBitmap) error {
 			i++
 		}
 	}
-	tower.layers[bitmap.Layer].image = canvas
+	session.layers[bitmap.Layer].image = canvas
 	return nil
 }
 
-func (tower *TowerRenderer) writeText(wt *pb.WriteText) error { // nolint: gocyclo
+func (session *drawSession) writeText(wt *pb.WriteText) error { // nolint: gocyclo
 	log.Debug("write text")
-	tower.activeLayers[wt.Layer] = true
-	layer := tower.layers[wt.Layer]
-	layer.dirty = true
-	canvas := layer.image
+	if err := session.checkLayer(wt.Layer); err != nil {
+		return err
+	}
+	if err := checkColor(wt.Color, "text color"); err != nil {
+		return err
+	}
+	if err := checkPaintMode(wt.PaintMode); err != nil {
+		return err
+	}
 	var fnt font.Font
-	var fntWidth int
 	var rect image.Rectangle
 
 	msg, err := font.ExpandAlias(wt.Text)
@@ -136,121 +221,183 @@ func (tower *TowerRenderer) writeText(wt *pb.WriteText) error { // nolint: gocyc
 
 	if wt.Font == "8x8" {
 		fnt = font.Font8x8
-		fntWidth = 8
 	} else if wt.Font == "6x8" {
 		fnt = font.Font6x8
-		fntWidth = 6
 	} else {
-		return errors.New("Unknown font")
+		return invalidArgument("unknown font %q", wt.Font)
 	}
 
+	// lines are stacked vertically, one font height apart
+	lines := strings.Split(msg, "\n")
 	textLen := 0
-	for _, r := range msg {
-		if _, ok := fnt.Bitmap[r]; ok {
-			textLen++
+	for _, line := range lines {
+		lineLen := 0
+		for _, r := range line {
+			if _, ok := fnt.Bitmap[r]; ok {
+				lineLen++
+			}
+		}
+		if lineLen > textLen {
+			textLen = lineLen
 		}
 	}
 
-	rect = image.Rect(int(wt.X), 0, int(wt.X)+fntWidth*textLen, 8)
-	canvas = resizeImage(canvas, rect)
+	rect = image.Rect(int(wt.X), 0, int(wt.X)+fnt.Width*textLen, fnt.Height*len(lines))
+	if err := session.checkCanvas(wt.Layer, rect); err != nil {
+		return err
+	}
+	session.activeLayers[wt.Layer] = true
+	layer := session.layer(wt.Layer)
+	canvas := resizeImage(layer.image, rect)
 	c := pbColorToColor(wt.Color)
-	x := int(wt.X)
-	for _, r := range msg {
-		if bmap, ok := fnt.Bitmap[r]; ok {
-			for _, glyph := range bmap {
-				for y := 0; y < 8; y++ {
-					if uint(glyph)&(1<<uint(y)) != 0 {
-						paint(canvas, x, y, c, int(wt.PaintMode))
+	for i, line := range lines {
+		x := int(wt.X)
+		y0 := i * fnt.Height
+		for _, r := range line {
+			if bmap, ok := fnt.Bitmap[r]; ok {
+				for _, glyph := range bmap {
+					for y := 0; y < fnt.Height; y++ {
+						if uint(glyph)&(1<<uint(y)) != 0 {
+							paint(canvas, x, y0+y, c, int(wt.PaintMode))
+						}
 					}
+					x++
 				}
-				x++
 			}
 		}
 	}
-	tower.layers[wt.Layer].image = canvas
+	session.layers[wt.Layer].image = canvas
 	return nil
 }
 
-func (tower *TowerRenderer) setLayerOrigin(origin *pb.SetLayerOrigin) error {
+func (session *drawSession) setLayerOrigin(origin *pb.SetLayerOrigin) error {
 	log.Debug("Set Layer Origin")
-	tower.activeLayers[origin.Layer] = true
-	layer := tower.layers[origin.Layer]
-	layer.dirty = true
-	layer.origin = image.Point{X: int(origin.Position.X), Y: int(origin.Position.Y)}
-	layer.image = resizeImage(
-		layer.image,
-		image.Rect(
-			layer.origin.X,
-			layer.origin.Y,
-			layer.origin.X+displayWidth,
-			layer.origin.Y+displayHeight))
+	if err := session.checkLayer(origin.Layer); err != nil {
+		return err
+	}
+	if err := checkPoint(origin.Position, "layer origin"); err != nil {
+		return err
+	}
+	position := image.Point{X: int(origin.Position.X), Y: int(origin.Position.Y)}
+	visible := image.Rect(
+		position.X,
+		position.Y,
+		position.X+session.config.Width,
+		position.Y+session.config.Height)
+	if err := session.checkCanvas(origin.Layer, visible); err != nil {
+		return err
+	}
+	session.activeLayers[origin.Layer] = true
+	layer := session.layer(origin.Layer)
+	layer.origin = position
+	layer.image = resizeImage(layer.image, visible)
 	return nil
 }
 
-func (tower *TowerRenderer) setLayerAlpha(alpha *pb.SetLayerAlpha) error {
+func (session *drawSession) setLayerAlpha(alpha *pb.SetLayerAlpha) error {
 	log.Debug("Set Layer Alpha")
-	tower.activeLayers[alpha.Layer] = true
-	layer := tower.layers[alpha.Layer]
-	layer.dirty = true
+	if err := session.checkLayer(alpha.Layer); err != nil {
+		return err
+	}
+	if alpha.Alpha > 0xffff {
+		return outOfRange("alpha %d out of range [0, 65535]", alpha.Alpha)
+	}
+	session.activeLayers[alpha.Layer] = true
+	layer := session.layer(alpha.Layer)
 	layer.alpha = int(alpha.Alpha)
 	return nil
 }
 
-func (tower *TowerRenderer) autoRoll(autoroll *pb.AutoRoll) error {
+func (session *drawSession) autoRoll(autoroll *pb.AutoRoll) error {
 	log.Debugf("AutoRoll (%v)", autoroll.Mode)
-	tower.activeLayers[autoroll.Layer] = true
-	layer := tower.layers[autoroll.Layer]
-	layer.dirty = true
+	if err := session.checkLayer(autoroll.Layer); err != nil {
+		return err
+	}
+	if err := checkRollingMode(int(autoroll.Mode)); err != nil {
+		return err
+	}
+	// the image is extended by the entry and the separator along the
+	// direction of the layer, which SetRolling may still change
+	bounds := session.layers[autoroll.Layer].image.Bounds()
+	extension := int(autoroll.Entry) + int(autoroll.Separator)
+	if err := session.checkCanvasSize(
+		autoroll.Layer, bounds.Max.X+extension, session.config.Height); err != nil {
+		return err
+	}
+	if err := session.checkCanvasSize(
+		autoroll.Layer, session.config.Width, bounds.Max.Y+extension); err != nil {
+		return err
+	}
+	session.activeLayers[autoroll.Layer] = true
+	layer := session.layer(autoroll.Layer)
 	layer.rolling.mode = int(autoroll.Mode)
 	layer.rolling.entry = int(autoroll.Entry)
 	layer.rolling.separator = int(autoroll.Separator)
 	return nil
 }
 
-// Draw implements the main task of the server, namely drawing on the display
+// Draw implements the main task of the server, namely drawing on the display.
+// If a request is invalid, the remaining requests are ignored, nothing is
+// displayed and the stream ends with an InvalidArgument or OutOfRange
+// status giving the index of the offending request.
 func (tower *TowerRenderer) Draw(stream pb.TowerDisplay_DrawServer) error { // nolint: gocyclo
 	var status error
-	for i := 0; i < maxLayers; i++ {
-		tower.layers[i].dirty = false
+	ctx, span := tracer.Start(stream.Context(), "Draw")
+	session := tower.newSession(ctx)
+	if client, ok := ClientFromContext(ctx); ok {
+		log.Debugf("Draw stream from %v", client.Name)
 	}
-	for {
+	tower.metrics.drawStreams.Inc()
+	defer tower.metrics.drawStreams.Dec()
+	for index := 0; ; index++ {
 		in, err := stream.Recv()
 		if err == io.EOF {
-			if status == nil {
-				tower.lsc <- tower.getLayersSet()
-			}
-			msg := ""
+			span.SetAttributes(attribute.Int("requests", index))
 			if status != nil {
-				msg = status.Error()
+				endSpan(span, status)
+				return status
 			}
-			return stream.SendAndClose(&pb.DrawResponse{
-				Message: msg,
-			})
+			tower.commit(ctx, session)
+			err = stream.SendAndClose(&pb.DrawResponse{})
+			endSpan(span, err)
+			return err
 		}
 		if err != nil {
+			endSpan(span, err)
 			return err
 		}
 
 		if status == nil {
+			_, reqSpan := tracer.Start(ctx, requestName(in), trace.WithAttributes(
+				attribute.Int("index", index),
+			))
 			switch t := in.Type.(type) {
 			case *pb.DrawRequest_Init:
-				status = tower.init(t.Init)
+				status = session.init(t.Init)
 			case *pb.DrawRequest_Clear:
-				status = tower.clear(t.Clear)
+				status = session.clear(t.Clear)
 			case *pb.DrawRequest_SetPixels:
-				status = tower.setPixels(t.SetPixels)
+				status = session.setPixels(t.SetPixels)
 			case *pb.DrawRequest_DrawRectangle:
-				status = tower.drawRectangle(t.DrawRectangle)
+				status = session.drawRectangle(t.DrawRectangle)
 			case *pb.DrawRequest_DrawBitmap:
-				status = tower.drawBitmap(t.DrawBitmap)
+				status = session.drawBitmap(t.DrawBitmap)
 			case *pb.DrawRequest_WriteText:
-				status = tower.writeText(t.WriteText)
+				status = session.writeText(t.WriteText)
 			case *pb.DrawRequest_SetLayerOrigin:
-				status = tower.setLayerOrigin(t.SetLayerOrigin)
+				status = session.setLayerOrigin(t.SetLayerOrigin)
 			case *pb.DrawRequest_SetLayerAlpha:
-				status = tower.setLayerAlpha(t.SetLayerAlpha)
+				status = session.setLayerAlpha(t.SetLayerAlpha)
 			case *pb.DrawRequest_AutoRoll:
-				status = tower.autoRoll(t.AutoRoll)
+				status = session.autoRoll(t.AutoRoll)
+			default:
+				status = invalidArgument("unsupported request %T", t)
+			}
+			tower.metrics.request(requestName(in), status)
+			endSpan(reqSpan, status)
+			if status != nil {
+				log.Debugf("Invalid request %d: %v", index, status)
+				status = requestError(index, status)
 			}
 		}
 	}
@@ -0,0 +1,93 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dmx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	artNetPort            = 6454
+	artNetProtocolVersion = 14
+	artNetOpDmx           = 0x5000
+	artNetOpSync          = 0x5200
+)
+
+var artNetID = []byte("Art-Net\x00")
+
+type artNet struct {
+	opts *Options
+}
+
+// NewArtNet returns an engine sending the LEDs with the Art-Net protocol
+// to the controller at opts.Address. The universes are 15 bits port
+// addresses (net, sub-net and universe).
+func NewArtNet(opts Options) *Engine {
+	opts.normalize()
+	p := &artNet{}
+	e := newEngine(opts, p)
+	p.opts = &e.opts
+	return e
+}
+
+func artNetHeader(packet []byte, opCode uint16) {
+	copy(packet[0:8], artNetID)
+	binary.LittleEndian.PutUint16(packet[8:], opCode)
+	binary.BigEndian.PutUint16(packet[10:], artNetProtocolVersion)
+}
+
+func (p *artNet) dmxPacket(universe int, sequence byte, data []byte) []byte {
+	packet := make([]byte, 18+len(data))
+	artNetHeader(packet, artNetOpDmx)
+	if sequence == 0 {
+		// 0 disables the sequence check
+		sequence = 1
+	}
+	packet[12] = sequence
+	packet[13] = 0                        // physical port
+	packet[14] = byte(universe)           // sub-net and universe
+	packet[15] = byte(universe>>8) & 0x7f // net
+	binary.BigEndian.PutUint16(packet[16:], uint16(len(data)))
+	copy(packet[18:], data)
+	return packet
+}
+
+func (p *artNet) syncPacket(sequence byte) []byte {
+	packet := make([]byte, 14)
+	artNetHeader(packet, artNetOpSync)
+	return packet
+}
+
+func (p *artNet) port() int {
+	return artNetPort
+}
+
+func (p *artNet) checkUniverse(universe int) error {
+	if universe < 0 || universe > 0x7fff {
+		return fmt.Errorf("Art-Net universe %d out of range [0, 32767]", universe)
+	}
+	return nil
+}
+
+func (p *artNet) multicast(universe int) *net.UDPAddr {
+	return nil
+}
+
+// syncUniverse returns a valid universe, ArtSync is not bound to any
+func (p *artNet) syncUniverse() int {
+	return 0
+}
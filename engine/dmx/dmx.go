@@ -0,0 +1,235 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dmx implements WsEngines driving network pixel controllers with
+// the E1.31 (sACN) and Art-Net protocols. The LEDs are packed as 3 DMX
+// slots each, in the order of the bytes of the LED values, into
+// consecutive universes.
+package dmx
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxUniverseSize      = 512
+	defaultUniverseSize  = 510 // 170 RGB LEDs
+	defaultChannelStride = 8
+)
+
+// Options configures a DMX engine
+type Options struct {
+	// Address is the address of the controller, with an optional port.
+	// If empty, E1.31 uses multicast and Art-Net fails to initialize.
+	Address string
+	// StartUniverse is the universe of the first LED of channel 0
+	StartUniverse int
+	// UniverseSize is the number of DMX slots used in each universe. It is
+	// rounded down to a multiple of 3 (default 510).
+	UniverseSize int
+	// ChannelStride is the number of universes between the first
+	// universes of two consecutive channels (default 8). A channel may not
+	// use more universes.
+	ChannelStride int
+	// Sync sends a synchronization packet after each frame, so that the
+	// controllers show all universes at the same time
+	Sync bool
+	// SyncUniverse is the E1.31 synchronization universe (default 63999)
+	SyncUniverse int
+	// SourceName and Priority are sent in E1.31 packets (defaults:
+	// "telecom-tower" and 100)
+	SourceName string
+	Priority   int
+}
+
+// protocol builds the packets of a DMX over IP protocol
+type protocol interface {
+	port() int
+	checkUniverse(universe int) error
+	// multicast returns the multicast address of a universe or nil if the
+	// protocol does not support multicast
+	multicast(universe int) *net.UDPAddr
+	dmxPacket(universe int, sequence byte, data []byte) []byte
+	syncPacket(sequence byte) []byte
+	syncUniverse() int
+}
+
+// Engine is a WsEngine sending the LEDs to DMX universes
+type Engine struct {
+	mu       sync.Mutex
+	opts     Options
+	proto    protocol
+	conn     *net.UDPConn
+	addr     *net.UDPAddr // unicast address, nil for multicast
+	channels map[int][]uint32
+	sequence map[int]byte
+	syncSeq  byte
+}
+
+func newEngine(opts Options, proto protocol) *Engine {
+	return &Engine{
+		opts:     opts,
+		proto:    proto,
+		channels: make(map[int][]uint32),
+		sequence: make(map[int]byte),
+	}
+}
+
+func (opts *Options) normalize() {
+	opts.UniverseSize -= opts.UniverseSize % 3
+	if opts.UniverseSize <= 0 || opts.UniverseSize > maxUniverseSize {
+		opts.UniverseSize = defaultUniverseSize
+	}
+	if opts.ChannelStride <= 0 {
+		opts.ChannelStride = defaultChannelStride
+	}
+}
+
+// Init resolves the address of the controller and opens the UDP socket
+func (e *Engine) Init() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.opts.Address == "" && e.proto.multicast(e.opts.StartUniverse) == nil {
+		return errors.New("No controller address")
+	}
+	if e.opts.Address != "" {
+		address := e.opts.Address
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, strconv.Itoa(e.proto.port()))
+		}
+		addr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			return errors.WithMessage(err, "Error resolving controller address")
+		}
+		e.addr = addr
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return errors.WithMessage(err, "Error opening UDP socket")
+	}
+	e.conn = conn
+	return nil
+}
+
+// Fini closes the UDP socket
+func (e *Engine) Fini() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn != nil {
+		e.conn.Close() // nolint: errcheck
+		e.conn = nil
+	}
+}
+
+// SetLedsSync stores the LEDs of a channel for the next rendering. The
+// LEDs of a channel must fit in ChannelStride universes, or they would
+// overwrite the first universes of the next channel.
+func (e *Engine) SetLedsSync(channel int, leds []uint32) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ledsPerUniverse := e.opts.UniverseSize / 3
+	if universes := (len(leds) + ledsPerUniverse - 1) / ledsPerUniverse; universes > e.opts.ChannelStride {
+		return errors.Errorf("Channel %d needs %d universes, more than the stride of %d",
+			channel, universes, e.opts.ChannelStride)
+	}
+	buf := e.channels[channel][:0]
+	e.channels[channel] = append(buf, leds...)
+	return nil
+}
+
+// Render sends the universes of all channels followed, if enabled, by a
+// synchronization packet
+func (e *Engine) Render() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return errors.New("Engine not initialized")
+	}
+	channels := make([]int, 0, len(e.channels))
+	for ch := range e.channels {
+		channels = append(channels, ch)
+	}
+	sort.Ints(channels)
+	ledsPerUniverse := e.opts.UniverseSize / 3
+	for _, ch := range channels {
+		leds := e.channels[ch]
+		universe := e.opts.StartUniverse + ch*e.opts.ChannelStride
+		for start := 0; start < len(leds); start += ledsPerUniverse {
+			end := start + ledsPerUniverse
+			if end > len(leds) {
+				end = len(leds)
+			}
+			if err := e.sendUniverse(universe, leds[start:end]); err != nil {
+				return err
+			}
+			universe++
+		}
+	}
+	if e.opts.Sync {
+		addr, err := e.destination(e.proto.syncUniverse())
+		if err != nil {
+			return err
+		}
+		e.syncSeq++
+		if _, err := e.conn.WriteToUDP(e.proto.syncPacket(e.syncSeq), addr); err != nil {
+			return errors.WithMessage(err, "Error sending sync packet")
+		}
+	}
+	return nil
+}
+
+func (e *Engine) sendUniverse(universe int, leds []uint32) error {
+	data := make([]byte, 0, 3*len(leds))
+	for _, c := range leds {
+		data = append(data, byte(c>>16), byte(c>>8), byte(c))
+	}
+	if len(data)%2 != 0 {
+		// Art-Net requires an even length, E1.31 does not mind
+		data = append(data, 0)
+	}
+	addr, err := e.destination(universe)
+	if err != nil {
+		return err
+	}
+	e.sequence[universe]++
+	packet := e.proto.dmxPacket(universe, e.sequence[universe], data)
+	if _, err := e.conn.WriteToUDP(packet, addr); err != nil {
+		return errors.WithMessage(err, "Error sending universe")
+	}
+	return nil
+}
+
+// destination returns the address of the packets of a universe
+func (e *Engine) destination(universe int) (*net.UDPAddr, error) {
+	if err := e.proto.checkUniverse(universe); err != nil {
+		return nil, err
+	}
+	if e.addr != nil {
+		return e.addr, nil
+	}
+	if addr := e.proto.multicast(universe); addr != nil {
+		return addr, nil
+	}
+	return nil, errors.New("No controller address")
+}
+
+// Wait does nothing, packets are sent synchronously
+func (e *Engine) Wait() error {
+	return nil
+}
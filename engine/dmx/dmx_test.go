@@ -0,0 +1,208 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dmx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// listen returns a UDP socket on the loopback interface
+func listen(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() }) // nolint: errcheck
+	return conn
+}
+
+// render sends the LEDs of channel 0 with a new engine and returns the
+// packets received by conn
+func render(t *testing.T, conn *net.UDPConn, newEngine func(Options) *Engine, opts Options, leds []uint32, packets int) [][]byte {
+	t.Helper()
+	opts.Address = conn.LocalAddr().String()
+	e := newEngine(opts)
+	if err := e.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Fini()
+	if err := e.SetLedsSync(0, leds); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Render(); err != nil {
+		t.Fatal(err)
+	}
+	var res [][]byte
+	buf := make([]byte, 1024)
+	for len(res) < packets {
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("packet %d: %v", len(res), err)
+		}
+		res = append(res, append([]byte(nil), buf[:n]...))
+	}
+	return res
+}
+
+// 3 LEDs with 2 LEDs per universe fill 2 universes
+var testLeds = []uint32{0x010203, 0x040506, 0x070809}
+
+func TestE131(t *testing.T) {
+	conn := listen(t)
+	opts := Options{StartUniverse: 5, UniverseSize: 6, Sync: true, SyncUniverse: 7000, Priority: 150}
+	packets := render(t, conn, NewE131, opts, testLeds, 3)
+
+	tests := []struct {
+		universe uint16
+		data     []byte
+	}{
+		{5, []byte{1, 2, 3, 4, 5, 6}},
+		{6, []byte{7, 8, 9, 0}},
+	}
+	for i, tt := range tests {
+		p := packets[i]
+		if len(p) != 126+len(tt.data) {
+			t.Fatalf("packet %d: length %d, want %d", i, len(p), 126+len(tt.data))
+		}
+		fields := []struct {
+			name      string
+			got, want int
+		}{
+			{"preamble size", int(binary.BigEndian.Uint16(p[0:])), 0x10},
+			{"root flags and length", int(binary.BigEndian.Uint16(p[16:])), 0x7000 | (len(p) - 16)},
+			{"root vector", int(binary.BigEndian.Uint32(p[18:])), e131VectorRootData},
+			{"framing flags and length", int(binary.BigEndian.Uint16(p[38:])), 0x7000 | (len(p) - 38)},
+			{"framing vector", int(binary.BigEndian.Uint32(p[40:])), e131VectorFrameData},
+			{"priority", int(p[108]), 150},
+			{"sync universe", int(binary.BigEndian.Uint16(p[109:])), 7000},
+			{"sequence", int(p[111]), 1},
+			{"universe", int(binary.BigEndian.Uint16(p[113:])), int(tt.universe)},
+			{"DMP flags and length", int(binary.BigEndian.Uint16(p[115:])), 0x7000 | (len(p) - 115)},
+			{"DMP vector", int(p[117]), e131VectorDMPSet},
+			{"address and data type", int(p[118]), 0xa1},
+			{"property value count", int(binary.BigEndian.Uint16(p[123:])), 1 + len(tt.data)},
+			{"start code", int(p[125]), 0},
+		}
+		for _, f := range fields {
+			if f.got != f.want {
+				t.Errorf("packet %d: %s = %#x, want %#x", i, f.name, f.got, f.want)
+			}
+		}
+		if !bytes.Equal(p[4:16], acnPacketIdentifier) {
+			t.Errorf("packet %d: identifier %q", i, p[4:16])
+		}
+		if name := string(bytes.TrimRight(p[44:108], "\x00")); name != e131DefaultSourceName {
+			t.Errorf("packet %d: source name %q", i, name)
+		}
+		if !bytes.Equal(p[126:], tt.data) {
+			t.Errorf("packet %d: data %v, want %v", i, p[126:], tt.data)
+		}
+	}
+
+	sync := packets[2]
+	if len(sync) != 49 {
+		t.Fatalf("sync packet: length %d, want 49", len(sync))
+	}
+	if v := binary.BigEndian.Uint32(sync[18:]); v != e131VectorRootExtended {
+		t.Errorf("sync packet: root vector %#x", v)
+	}
+	if v := binary.BigEndian.Uint32(sync[40:]); v != e131VectorFrameSync {
+		t.Errorf("sync packet: framing vector %#x", v)
+	}
+	if u := binary.BigEndian.Uint16(sync[45:]); u != 7000 {
+		t.Errorf("sync packet: universe %d, want 7000", u)
+	}
+}
+
+func TestArtNet(t *testing.T) {
+	conn := listen(t)
+	opts := Options{StartUniverse: 0x1ff, UniverseSize: 6, Sync: true}
+	packets := render(t, conn, NewArtNet, opts, testLeds, 3)
+
+	tests := []struct {
+		universe int
+		data     []byte
+	}{
+		{0x1ff, []byte{1, 2, 3, 4, 5, 6}},
+		{0x200, []byte{7, 8, 9, 0}},
+	}
+	for i, tt := range tests {
+		p := packets[i]
+		if len(p) != 18+len(tt.data) {
+			t.Fatalf("packet %d: length %d, want %d", i, len(p), 18+len(tt.data))
+		}
+		fields := []struct {
+			name      string
+			got, want int
+		}{
+			{"opcode", int(binary.LittleEndian.Uint16(p[8:])), artNetOpDmx},
+			{"protocol version", int(binary.BigEndian.Uint16(p[10:])), artNetProtocolVersion},
+			{"sequence", int(p[12]), 1},
+			{"sub-net and universe", int(p[14]), tt.universe & 0xff},
+			{"net", int(p[15]), tt.universe >> 8},
+			{"length", int(binary.BigEndian.Uint16(p[16:])), len(tt.data)},
+		}
+		for _, f := range fields {
+			if f.got != f.want {
+				t.Errorf("packet %d: %s = %#x, want %#x", i, f.name, f.got, f.want)
+			}
+		}
+		if !bytes.Equal(p[0:8], artNetID) {
+			t.Errorf("packet %d: ID %q", i, p[0:8])
+		}
+		if !bytes.Equal(p[18:], tt.data) {
+			t.Errorf("packet %d: data %v, want %v", i, p[18:], tt.data)
+		}
+	}
+
+	sync := packets[2]
+	if len(sync) != 14 || binary.LittleEndian.Uint16(sync[8:]) != artNetOpSync {
+		t.Errorf("sync packet %v", sync)
+	}
+}
+
+func TestArtNetNeedsAddress(t *testing.T) {
+	e := NewArtNet(Options{})
+	if err := e.Init(); err == nil {
+		e.Fini()
+		t.Fatal("Init succeeded without address")
+	}
+}
+
+func TestChannelStride(t *testing.T) {
+	tests := []struct {
+		leds    int
+		wantErr bool
+	}{
+		{leds: 0},
+		{leds: 4},                // 2 universes
+		{leds: 5, wantErr: true}, // 3 universes
+	}
+	for _, tt := range tests {
+		e := NewArtNet(Options{UniverseSize: 6, ChannelStride: 2})
+		err := e.SetLedsSync(1, make([]uint32, tt.leds))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d LEDs: error %v, want error %v", tt.leds, err, tt.wantErr)
+		}
+	}
+}
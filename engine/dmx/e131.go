@@ -0,0 +1,140 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dmx
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	e131Port              = 5568
+	e131DefaultPriority   = 100
+	e131DefaultSourceName = "telecom-tower"
+	e131MaxUniverse       = 63999
+
+	e131VectorRootData     = 0x00000004
+	e131VectorRootExtended = 0x00000008
+	e131VectorFrameData    = 0x00000002
+	e131VectorFrameSync    = 0x00000001
+	e131VectorDMPSet       = 0x02
+)
+
+var acnPacketIdentifier = []byte("ASC-E1.17\x00\x00\x00")
+
+type e131 struct {
+	opts *Options
+	cid  [16]byte
+}
+
+// NewE131 returns an engine sending the LEDs with the E1.31 (sACN)
+// protocol, in multicast if no address is given
+func NewE131(opts Options) *Engine {
+	opts.normalize()
+	if opts.Priority <= 0 || opts.Priority > 200 {
+		opts.Priority = e131DefaultPriority
+	}
+	if opts.SourceName == "" {
+		opts.SourceName = e131DefaultSourceName
+	}
+	if opts.StartUniverse <= 0 {
+		opts.StartUniverse = 1
+	}
+	if opts.SyncUniverse <= 0 {
+		opts.SyncUniverse = e131MaxUniverse
+	}
+	p := &e131{}
+	_, _ = rand.Read(p.cid[:])
+	e := newEngine(opts, p)
+	p.opts = &e.opts
+	return e
+}
+
+// flagsAndLength returns the PDU header of a PDU starting at offset in a
+// packet of the given size
+func flagsAndLength(size, offset int) uint16 {
+	return 0x7000 | uint16(size-offset)
+}
+
+func (p *e131) rootLayer(packet []byte, vector uint32) {
+	binary.BigEndian.PutUint16(packet[0:], 0x0010) // preamble size
+	binary.BigEndian.PutUint16(packet[2:], 0x0000) // post-amble size
+	copy(packet[4:16], acnPacketIdentifier)
+	binary.BigEndian.PutUint16(packet[16:], flagsAndLength(len(packet), 16))
+	binary.BigEndian.PutUint32(packet[18:], vector)
+	copy(packet[22:38], p.cid[:])
+}
+
+func (p *e131) dmxPacket(universe int, sequence byte, data []byte) []byte {
+	packet := make([]byte, 126+len(data))
+	p.rootLayer(packet, e131VectorRootData)
+
+	// framing layer
+	binary.BigEndian.PutUint16(packet[38:], flagsAndLength(len(packet), 38))
+	binary.BigEndian.PutUint32(packet[40:], e131VectorFrameData)
+	copy(packet[44:107], p.opts.SourceName) // null terminated
+	packet[108] = byte(p.opts.Priority)
+	if p.opts.Sync {
+		binary.BigEndian.PutUint16(packet[109:], uint16(p.opts.SyncUniverse))
+	}
+	packet[111] = sequence
+	packet[112] = 0 // options
+	binary.BigEndian.PutUint16(packet[113:], uint16(universe))
+
+	// DMP layer
+	binary.BigEndian.PutUint16(packet[115:], flagsAndLength(len(packet), 115))
+	packet[117] = e131VectorDMPSet
+	packet[118] = 0xa1                                            // address and data type
+	binary.BigEndian.PutUint16(packet[119:], 0)                   // first property address
+	binary.BigEndian.PutUint16(packet[121:], 1)                   // address increment
+	binary.BigEndian.PutUint16(packet[123:], uint16(1+len(data))) // property value count
+	packet[125] = 0                                               // DMX start code
+	copy(packet[126:], data)
+	return packet
+}
+
+func (p *e131) syncPacket(sequence byte) []byte {
+	packet := make([]byte, 49)
+	p.rootLayer(packet, e131VectorRootExtended)
+	binary.BigEndian.PutUint16(packet[38:], flagsAndLength(len(packet), 38))
+	binary.BigEndian.PutUint32(packet[40:], e131VectorFrameSync)
+	packet[44] = sequence
+	binary.BigEndian.PutUint16(packet[45:], uint16(p.opts.SyncUniverse))
+	return packet
+}
+
+func (p *e131) port() int {
+	return e131Port
+}
+
+func (p *e131) checkUniverse(universe int) error {
+	if universe < 1 || universe > e131MaxUniverse {
+		return fmt.Errorf("E1.31 universe %d out of range [1, %d]", universe, e131MaxUniverse)
+	}
+	return nil
+}
+
+func (p *e131) multicast(universe int) *net.UDPAddr {
+	return &net.UDPAddr{
+		IP:   net.IPv4(239, 255, byte(universe>>8), byte(universe)),
+		Port: e131Port,
+	}
+}
+
+func (p *e131) syncUniverse() int {
+	return p.opts.SyncUniverse
+}
@@ -0,0 +1,286 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recorder implements a WsEngine capturing the frames of the
+// display as PNG snapshots or as an animated GIF. The LEDs are drawn as
+// round dots on a black background.
+package recorder
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	renderer "github.com/telecom-tower/grpc-renderer"
+)
+
+const (
+	defaultScale = 8
+	// about a minute at 30 frames per second
+	defaultMaxFrames = 2000
+	// delay of the last frame of a GIF, in 100ths of a second
+	lastFrameDelay = 100
+)
+
+// Options are the options of a recorder
+type Options struct {
+	// Scale is the size of a LED in the recorded images (default 8 pixels)
+	Scale int
+	// MaxFrames is the maximum number of recorded frames (default 2000).
+	// The frames of an animated GIF are kept in memory until Fini and each
+	// PNG snapshot is a file, so the recording stops when the limit is
+	// reached.
+	MaxFrames int
+	// Next is an engine receiving all calls made to the recorder. It makes
+	// it possible to record the frames sent to a real device.
+	Next renderer.WsEngine
+}
+
+// Recorder is a WsEngine recording the frames
+type Recorder struct {
+	mu      sync.Mutex
+	next    renderer.WsEngine
+	decoder *renderer.FrameDecoder
+	frame   *image.RGBA
+	scale   int
+	dot     *image.Alpha
+
+	// PNG snapshots
+	dir   string
+	count int
+
+	// animated GIF
+	filename  string
+	anim      *gif.GIF
+	last      time.Time
+	maxFrames int
+}
+
+func newRecorder(config renderer.Config, opts Options) *Recorder {
+	if opts.Scale <= 0 {
+		opts.Scale = defaultScale
+	}
+	if opts.MaxFrames <= 0 {
+		opts.MaxFrames = defaultMaxFrames
+	}
+	r := &Recorder{
+		next:      opts.Next,
+		scale:     opts.Scale,
+		dot:       dotMask(opts.Scale),
+		maxFrames: opts.MaxFrames,
+	}
+	r.decoder = renderer.NewFrameDecoder(config, r)
+	r.frame = image.NewRGBA(r.decoder.Bounds())
+	return r
+}
+
+// NewPNG returns a recorder writing each rendered frame to a numbered PNG
+// file in dir, up to opts.MaxFrames files
+func NewPNG(dir string, config renderer.Config, opts Options) *Recorder {
+	r := newRecorder(config, opts)
+	r.dir = dir
+	return r
+}
+
+// NewGIF returns a recorder writing the rendered frames, with their
+// timing, to an animated GIF. The file is written by Fini and holds at
+// most opts.MaxFrames frames.
+func NewGIF(filename string, config renderer.Config, opts Options) *Recorder {
+	r := newRecorder(config, opts)
+	r.filename = filename
+	r.anim = &gif.GIF{}
+	return r
+}
+
+// dotMask returns the mask of a round LED of the given size
+func dotMask(size int) *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, size, size))
+	c := float64(size) / 2
+	radius := c - 0.5 // keep a small gap between LEDs
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			dx, dy := float64(x)+0.5-c, float64(y)+0.5-c
+			if dx*dx+dy*dy <= radius*radius {
+				mask.SetAlpha(x, y, color.Alpha{A: 0xff})
+			}
+		}
+	}
+	return mask
+}
+
+// Init initializes the next engine, if any
+func (r *Recorder) Init() error {
+	if r.dir != "" {
+		if err := os.MkdirAll(r.dir, 0755); err != nil {
+			return errors.WithMessage(err, "Error creating snapshot directory")
+		}
+	}
+	if r.next != nil {
+		return r.next.Init()
+	}
+	return nil
+}
+
+// Fini writes the animated GIF and finalizes the next engine, if any
+func (r *Recorder) Fini() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.anim != nil && len(r.anim.Image) > 0 {
+		r.anim.Delay[len(r.anim.Delay)-1] = lastFrameDelay
+		if err := r.writeGIF(); err != nil {
+			log.Errorf("Error writing GIF: %v", err)
+		}
+	}
+	if r.next != nil {
+		r.next.Fini()
+	}
+}
+
+// SetLedsSync captures the LEDs of a channel and forwards them to the next
+// engine, if any
+func (r *Recorder) SetLedsSync(channel int, leds []uint32) error {
+	r.mu.Lock()
+	r.decoder.Decode(r.frame, channel, leds)
+	r.mu.Unlock()
+	if r.next != nil {
+		return r.next.SetLedsSync(channel, leds)
+	}
+	return nil
+}
+
+// Render records the current frame
+func (r *Recorder) Render() error {
+	if r.next != nil {
+		if err := r.next.Render(); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.anim != nil {
+		if len(r.anim.Image) >= r.maxFrames {
+			return nil
+		}
+		r.addGIFFrame(r.dots(), time.Now())
+		if len(r.anim.Image) == r.maxFrames {
+			log.Warnf("GIF recording stopped after %d frames", r.maxFrames)
+		}
+		return nil
+	}
+	if r.count >= r.maxFrames {
+		return nil
+	}
+	r.count++
+	if r.count == r.maxFrames {
+		log.Warnf("PNG recording stopped after %d frames", r.maxFrames)
+	}
+	return r.writePNG(r.dots(), filepath.Join(r.dir, fmt.Sprintf("frame-%06d.png", r.count)))
+}
+
+// Wait waits for the next engine, if any
+func (r *Recorder) Wait() error {
+	if r.next != nil {
+		return r.next.Wait()
+	}
+	return nil
+}
+
+// dots returns the current frame scaled up, with round LEDs
+func (r *Recorder) dots() *image.RGBA {
+	bounds := r.frame.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx()*r.scale, bounds.Dy()*r.scale))
+	draw.Draw(img, img.Bounds(), image.Black, image.Point{}, draw.Src)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			rect := image.Rect(0, 0, r.scale, r.scale).Add(
+				image.Pt(x-bounds.Min.X, y-bounds.Min.Y).Mul(r.scale))
+			draw.DrawMask(img, rect, image.NewUniform(r.frame.At(x, y)),
+				image.Point{}, r.dot, image.Point{}, draw.Over)
+		}
+	}
+	return img
+}
+
+func (r *Recorder) writePNG(img image.Image, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return errors.WithMessage(err, "Error creating snapshot")
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close() // nolint: errcheck
+		return errors.WithMessage(err, "Error encoding snapshot")
+	}
+	return f.Close()
+}
+
+// addGIFFrame appends a frame and sets the delay of the previous frame
+// from the actual time elapsed between them
+func (r *Recorder) addGIFFrame(img *image.RGBA, now time.Time) {
+	if n := len(r.anim.Image); n > 0 {
+		delay := int(now.Sub(r.last) / (10 * time.Millisecond))
+		if delay < 2 {
+			// most viewers do not honor shorter delays
+			delay = 2
+		}
+		r.anim.Delay[n-1] = delay
+	}
+	r.last = now
+	frame := image.NewPaletted(img.Bounds(), framePalette(img))
+	draw.Draw(frame, frame.Bounds(), img, image.Point{}, draw.Src)
+	r.anim.Image = append(r.anim.Image, frame)
+	r.anim.Delay = append(r.anim.Delay, 0)
+}
+
+// framePalette returns the exact palette of the image if it has at most
+// 256 colors and a generic palette otherwise
+func framePalette(img *image.RGBA) color.Palette {
+	colors := make(map[color.RGBA]bool)
+	var p color.Palette
+	bounds := img.Bounds()
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			c := img.RGBAAt(x, y)
+			if !colors[c] {
+				if len(p) == 256 {
+					return palette.Plan9
+				}
+				colors[c] = true
+				p = append(p, c)
+			}
+		}
+	}
+	return p
+}
+
+func (r *Recorder) writeGIF() error {
+	f, err := os.Create(r.filename)
+	if err != nil {
+		return errors.WithMessage(err, "Error creating GIF")
+	}
+	if err := gif.EncodeAll(f, r.anim); err != nil {
+		f.Close() // nolint: errcheck
+		return errors.WithMessage(err, "Error encoding GIF")
+	}
+	return f.Close()
+}
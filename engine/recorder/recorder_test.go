@@ -0,0 +1,96 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+
+	renderer "github.com/telecom-tower/grpc-renderer"
+)
+
+func TestGIFMaxFrames(t *testing.T) {
+	tests := []struct {
+		renders   int
+		maxFrames int
+		want      int
+	}{
+		{renders: 2, maxFrames: 3, want: 2},
+		{renders: 5, maxFrames: 3, want: 3},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(t.TempDir(), "anim.gif")
+		r := NewGIF(filename, renderer.Config{Width: 4, Height: 2}, Options{Scale: 2, MaxFrames: tt.maxFrames})
+		if err := r.Init(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < tt.renders; i++ {
+			if err := r.Render(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r.Fini()
+
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		anim, err := gif.DecodeAll(f)
+		f.Close() // nolint: errcheck
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(anim.Image) != tt.want {
+			t.Errorf("%d renders: %d frames, want %d", tt.renders, len(anim.Image), tt.want)
+		}
+		if d := anim.Delay[len(anim.Delay)-1]; d != lastFrameDelay {
+			t.Errorf("%d renders: last delay %d, want %d", tt.renders, d, lastFrameDelay)
+		}
+	}
+}
+
+func TestPNGMaxFrames(t *testing.T) {
+	tests := []struct {
+		renders   int
+		maxFrames int
+		want      int
+	}{
+		{renders: 2, maxFrames: 3, want: 2},
+		{renders: 5, maxFrames: 3, want: 3},
+	}
+	for _, tt := range tests {
+		dir := filepath.Join(t.TempDir(), "frames")
+		r := NewPNG(dir, renderer.Config{Width: 4, Height: 2}, Options{Scale: 2, MaxFrames: tt.maxFrames})
+		if err := r.Init(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < tt.renders; i++ {
+			if err := r.Render(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r.Fini()
+
+		files, err := filepath.Glob(filepath.Join(dir, "frame-*.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != tt.want {
+			t.Errorf("%d renders: %d snapshots, want %d", tt.renders, len(files), tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tee implements a WsEngine forwarding all calls to several
+// engines, for example to drive the tower and a simulator at the same
+// time.
+package tee
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	renderer "github.com/telecom-tower/grpc-renderer"
+)
+
+// Policy defines how the error of an engine affects the others
+type Policy int
+
+const (
+	// FailFast stops at the first failing engine and returns its error.
+	// The remaining engines are not called.
+	FailFast Policy = iota
+	// BestEffort calls all engines and returns the first error
+	BestEffort
+	// LogAndContinue calls all engines and logs the errors without
+	// returning them
+	LogAndContinue
+)
+
+// Engine is a WsEngine forwarding the calls to several engines
+type Engine struct {
+	policy      Policy
+	engines     []renderer.WsEngine
+	initialized []bool // engines to finalize
+}
+
+// New returns an engine forwarding the calls to the given engines, in
+// order, handling errors according to the policy
+func New(policy Policy, engines ...renderer.WsEngine) *Engine {
+	return &Engine{
+		policy:  policy,
+		engines: engines,
+	}
+}
+
+// forward calls f on each engine and combines the errors according to the
+// policy
+func (t *Engine) forward(op string, f func(i int, e renderer.WsEngine) error) error {
+	var first error
+	for i, e := range t.engines {
+		err := f(i, e)
+		if err == nil {
+			continue
+		}
+		err = errors.WithMessage(err, fmt.Sprintf("%s failed on engine %d", op, i))
+		switch t.policy {
+		case FailFast:
+			return err
+		case BestEffort:
+			if first == nil {
+				first = err
+			}
+		default:
+			log.Warn(err)
+		}
+	}
+	return first
+}
+
+// Init initializes all engines. If it returns an error, the engines
+// already initialized are finalized. With the LogAndContinue policy, it
+// never fails and the engines which failed are not finalized by Fini.
+func (t *Engine) Init() error {
+	t.initialized = make([]bool, len(t.engines))
+	err := t.forward("Init", func(i int, e renderer.WsEngine) error {
+		if err := e.Init(); err != nil {
+			return err
+		}
+		t.initialized[i] = true
+		return nil
+	})
+	if err != nil {
+		t.Fini()
+	}
+	return err
+}
+
+// Fini finalizes the initialized engines
+func (t *Engine) Fini() {
+	for i, ok := range t.initialized {
+		if ok {
+			t.engines[i].Fini()
+		}
+	}
+	t.initialized = nil
+}
+
+// SetLedsSync sends the LEDs to all engines
+func (t *Engine) SetLedsSync(channel int, leds []uint32) error {
+	return t.forward("SetLedsSync", func(_ int, e renderer.WsEngine) error {
+		return e.SetLedsSync(channel, leds)
+	})
+}
+
+// Render renders the LEDs on all engines
+func (t *Engine) Render() error {
+	return t.forward("Render", func(_ int, e renderer.WsEngine) error {
+		return e.Render()
+	})
+}
+
+// Wait waits for all engines
+func (t *Engine) Wait() error {
+	return t.forward("Wait", func(_ int, e renderer.WsEngine) error {
+		return e.Wait()
+	})
+}
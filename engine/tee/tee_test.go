@@ -0,0 +1,68 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tee
+
+import (
+	"errors"
+	"testing"
+
+	renderer "github.com/telecom-tower/grpc-renderer"
+)
+
+// fakeEngine counts the calls to Init and Fini
+type fakeEngine struct {
+	initErr error
+	inits   int
+	finis   int
+}
+
+func (e *fakeEngine) Init() error                     { e.inits++; return e.initErr }
+func (e *fakeEngine) Fini()                           { e.finis++ }
+func (e *fakeEngine) Render() error                   { return nil }
+func (e *fakeEngine) Wait() error                     { return nil }
+func (e *fakeEngine) SetLedsSync(int, []uint32) error { return nil }
+
+func TestInitFailure(t *testing.T) {
+	tests := []struct {
+		policy    Policy
+		wantErr   bool
+		wantInits []int
+		wantFinis []int // after Init and Fini
+	}{
+		{FailFast, true, []int{1, 1, 0}, []int{1, 0, 0}},
+		{BestEffort, true, []int{1, 1, 1}, []int{1, 0, 1}},
+		{LogAndContinue, false, []int{1, 1, 1}, []int{1, 0, 1}},
+	}
+	for _, tt := range tests {
+		engines := []*fakeEngine{{}, {initErr: errors.New("no device")}, {}}
+		tee := New(tt.policy, engines[0], engines[1], engines[2])
+		err := tee.Init()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("policy %d: Init error %v, want error %v", tt.policy, err, tt.wantErr)
+		}
+		// the server only finalizes an engine which initialized
+		if err == nil {
+			tee.Fini()
+		}
+		for i, e := range engines {
+			if e.inits != tt.wantInits[i] || e.finis != tt.wantFinis[i] {
+				t.Errorf("policy %d, engine %d: %d Init and %d Fini, want %d and %d",
+					tt.policy, i, e.inits, e.finis, tt.wantInits[i], tt.wantFinis[i])
+			}
+		}
+	}
+}
+
+var _ renderer.WsEngine = &fakeEngine{}
@@ -0,0 +1,93 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package terminal implements a WsEngine showing the display in an ANSI
+// true color terminal. Each character cell shows two pixels stacked
+// vertically using the "upper half block" character.
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+
+	renderer "github.com/telecom-tower/grpc-renderer"
+)
+
+// Engine is a WsEngine rendering in a terminal
+type Engine struct {
+	mu      sync.Mutex
+	w       io.Writer
+	decoder *renderer.FrameDecoder
+	frame   *image.RGBA
+	drawn   bool // the frame has already been drawn once
+}
+
+// New returns a new terminal engine writing to w and showing a display
+// with the given configuration
+func New(w io.Writer, config renderer.Config) *Engine {
+	e := &Engine{w: w}
+	e.decoder = renderer.NewFrameDecoder(config, e)
+	e.frame = image.NewRGBA(e.decoder.Bounds())
+	return e
+}
+
+// Init hides the cursor
+func (e *Engine) Init() error {
+	_, err := io.WriteString(e.w, "\x1b[?25l")
+	return err
+}
+
+// Fini restores the attributes and the cursor of the terminal
+func (e *Engine) Fini() {
+	_, _ = io.WriteString(e.w, "\x1b[0m\x1b[?25h\n")
+}
+
+// SetLedsSync stores the LEDs of a channel for the next rendering
+func (e *Engine) SetLedsSync(channel int, leds []uint32) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.decoder.Decode(e.frame, channel, leds)
+	return nil
+}
+
+// Render draws the frame, overwriting the previous one
+func (e *Engine) Render() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	bounds := e.frame.Bounds()
+	rows := (bounds.Dy() + 1) / 2
+	b := bufio.NewWriter(e.w)
+	if e.drawn {
+		fmt.Fprintf(b, "\x1b[%dA", rows) // nolint: errcheck
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			top := e.frame.RGBAAt(x, y)
+			bottom := e.frame.RGBAAt(x, y+1)                          // black outside of the frame
+			fmt.Fprintf(b, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", // nolint: errcheck
+				top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+		}
+		fmt.Fprint(b, "\x1b[0m\n") // nolint: errcheck
+	}
+	e.drawn = true
+	return b.Flush()
+}
+
+// Wait does nothing, rendering is synchronous
+func (e *Engine) Wait() error {
+	return nil
+}
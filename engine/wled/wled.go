@@ -0,0 +1,236 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wled implements a WsEngine driving WLED based controllers (and
+// other controllers speaking DDP) over UDP. The channels are sent one
+// after the other as a single strip: channel 0 first, then channel 1...
+package wled
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Protocol is the UDP protocol used to send the LEDs
+type Protocol int
+
+const (
+	// DDP is the Distributed Display Protocol. Frames are split in packets
+	// of 480 LEDs, the last one being flagged to push the frame.
+	DDP Protocol = iota
+	// DRGB is the WLED realtime protocol for up to 490 LEDs. Larger frames
+	// are sent with DNRGB.
+	DRGB
+	// DNRGB is the WLED realtime protocol with a start index, frames are
+	// split in packets of 489 LEDs
+	DNRGB
+)
+
+const (
+	ddpPort  = 4048
+	wledPort = 21324
+
+	ddpHeaderSize    = 10
+	ddpMaxLeds       = 480
+	ddpFlagVersion1  = 0x40
+	ddpFlagPush      = 0x01
+	ddpTypeRGB24     = 0x0b
+	ddpDefaultOutput = 1
+
+	wledDRGB       = 2
+	wledDNRGB      = 4
+	drgbMaxLeds    = 490
+	dnrgbMaxLeds   = 489
+	defaultTimeout = 2
+	maxTimeout     = 255
+)
+
+// Options configures the engine
+type Options struct {
+	// Address is the address of the controller, with an optional port
+	Address string
+	// Protocol is the protocol used (default DDP)
+	Protocol Protocol
+	// Timeout is the number of seconds WLED waits after the last packet
+	// before going back to its own effects (default 2, 255 means never).
+	// It is not used by DDP.
+	Timeout int
+}
+
+// Engine is a WsEngine sending the LEDs to a controller over UDP
+type Engine struct {
+	mu       sync.Mutex
+	opts     Options
+	conn     *net.UDPConn
+	channels map[int][]uint32
+	sequence byte
+}
+
+// New returns a new engine
+func New(opts Options) *Engine {
+	if opts.Timeout <= 0 || opts.Timeout > maxTimeout {
+		opts.Timeout = defaultTimeout
+	}
+	return &Engine{
+		opts:     opts,
+		channels: make(map[int][]uint32),
+	}
+}
+
+// Init connects the UDP socket to the controller
+func (e *Engine) Init() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	port := wledPort
+	if e.opts.Protocol == DDP {
+		port = ddpPort
+	}
+	address := e.opts.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, strconv.Itoa(port))
+	}
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return errors.WithMessage(err, "Error resolving controller address")
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return errors.WithMessage(err, "Error opening UDP socket")
+	}
+	e.conn = conn
+	return nil
+}
+
+// Fini closes the UDP socket
+func (e *Engine) Fini() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn != nil {
+		e.conn.Close() // nolint: errcheck
+		e.conn = nil
+	}
+}
+
+// SetLedsSync stores the LEDs of a channel for the next rendering
+func (e *Engine) SetLedsSync(channel int, leds []uint32) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buf := e.channels[channel][:0]
+	e.channels[channel] = append(buf, leds...)
+	return nil
+}
+
+// Render sends the frame to the controller
+func (e *Engine) Render() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return errors.New("Engine not initialized")
+	}
+	var packets [][]byte
+	leds := e.strip()
+	switch {
+	case e.opts.Protocol == DDP:
+		packets = e.ddpPackets(leds)
+	case e.opts.Protocol == DRGB && len(leds) <= drgbMaxLeds:
+		packets = e.drgbPackets(leds)
+	default:
+		packets = e.dnrgbPackets(leds)
+	}
+	for _, packet := range packets {
+		if _, err := e.conn.Write(packet); err != nil {
+			return errors.WithMessage(err, "Error sending packet")
+		}
+	}
+	return nil
+}
+
+// Wait does nothing, packets are sent synchronously
+func (e *Engine) Wait() error {
+	return nil
+}
+
+// strip returns the LEDs of all channels, in channel order
+func (e *Engine) strip() []uint32 {
+	channels := make([]int, 0, len(e.channels))
+	for ch := range e.channels {
+		channels = append(channels, ch)
+	}
+	sort.Ints(channels)
+	var leds []uint32
+	for _, ch := range channels {
+		leds = append(leds, e.channels[ch]...)
+	}
+	return leds
+}
+
+func appendRGB(buf []byte, leds []uint32) []byte {
+	for _, c := range leds {
+		buf = append(buf, byte(c>>16), byte(c>>8), byte(c))
+	}
+	return buf
+}
+
+func (e *Engine) ddpPackets(leds []uint32) [][]byte {
+	// sequence numbers run from 1 to 15, 0 means unused
+	e.sequence = e.sequence%15 + 1
+	n := (len(leds) + ddpMaxLeds - 1) / ddpMaxLeds
+	if n == 0 {
+		// push even an empty frame
+		n = 1
+	}
+	packets := make([][]byte, n)
+	for i := range packets {
+		start := i * ddpMaxLeds
+		end := start + ddpMaxLeds
+		if end > len(leds) {
+			end = len(leds)
+		}
+		packet := make([]byte, ddpHeaderSize, ddpHeaderSize+3*(end-start))
+		packet[0] = ddpFlagVersion1
+		if i == n-1 {
+			packet[0] |= ddpFlagPush
+		}
+		packet[1] = e.sequence
+		packet[2] = ddpTypeRGB24
+		packet[3] = ddpDefaultOutput
+		binary.BigEndian.PutUint32(packet[4:], uint32(3*start))
+		binary.BigEndian.PutUint16(packet[8:], uint16(3*(end-start)))
+		packets[i] = appendRGB(packet, leds[start:end])
+	}
+	return packets
+}
+
+func (e *Engine) drgbPackets(leds []uint32) [][]byte {
+	packet := []byte{wledDRGB, byte(e.opts.Timeout)}
+	return [][]byte{appendRGB(packet, leds)}
+}
+
+func (e *Engine) dnrgbPackets(leds []uint32) [][]byte {
+	var packets [][]byte
+	for start := 0; start < len(leds); start += dnrgbMaxLeds {
+		end := start + dnrgbMaxLeds
+		if end > len(leds) {
+			end = len(leds)
+		}
+		packet := []byte{wledDNRGB, byte(e.opts.Timeout), byte(start >> 8), byte(start)}
+		packets = append(packets, appendRGB(packet, leds[start:end]))
+	}
+	return packets
+}
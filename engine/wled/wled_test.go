@@ -0,0 +1,150 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wled
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// render sends count LEDs with the given protocol and returns the packets
+// received by the controller
+func render(t *testing.T, protocol Protocol, count, packets int) [][]byte {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // nolint: errcheck
+	e := New(Options{Address: conn.LocalAddr().String(), Protocol: protocol})
+	if err := e.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Fini()
+	leds := make([]uint32, count)
+	for i := range leds {
+		leds[i] = uint32(i)
+	}
+	if err := e.SetLedsSync(0, leds); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Render(); err != nil {
+		t.Fatal(err)
+	}
+	var res [][]byte
+	buf := make([]byte, 2048)
+	for len(res) < packets {
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("packet %d: %v", len(res), err)
+		}
+		res = append(res, append([]byte(nil), buf[:n]...))
+	}
+	return res
+}
+
+// checkLeds checks that data holds the LEDs [start, start+n) set by render
+func checkLeds(t *testing.T, i int, data []byte, start, n int) {
+	t.Helper()
+	if len(data) != 3*n {
+		t.Errorf("packet %d: %d bytes of data, want %d", i, len(data), 3*n)
+		return
+	}
+	for j := 0; j < n; j++ {
+		c := uint32(start + j)
+		if data[3*j] != byte(c>>16) || data[3*j+1] != byte(c>>8) || data[3*j+2] != byte(c) {
+			t.Errorf("packet %d: LED %d is %v", i, start+j, data[3*j:3*j+3])
+			return
+		}
+	}
+}
+
+func TestDDP(t *testing.T) {
+	tests := []struct {
+		leds  int
+		sizes []int
+	}{
+		{0, []int{0}},
+		{480, []int{480}},
+		{489, []int{480, 9}},
+		{490, []int{480, 10}},
+		{960, []int{480, 480}},
+	}
+	for _, tt := range tests {
+		packets := render(t, DDP, tt.leds, len(tt.sizes))
+		start := 0
+		for i, size := range tt.sizes {
+			p := packets[i]
+			flags := byte(ddpFlagVersion1)
+			if i == len(tt.sizes)-1 {
+				flags |= ddpFlagPush
+			}
+			if p[0] != flags || p[1] != 1 || p[2] != ddpTypeRGB24 || p[3] != ddpDefaultOutput {
+				t.Errorf("%d LEDs, packet %d: header %v", tt.leds, i, p[:4])
+			}
+			if offset := binary.BigEndian.Uint32(p[4:]); offset != uint32(3*start) {
+				t.Errorf("%d LEDs, packet %d: offset %d, want %d", tt.leds, i, offset, 3*start)
+			}
+			if length := binary.BigEndian.Uint16(p[8:]); length != uint16(3*size) {
+				t.Errorf("%d LEDs, packet %d: length %d, want %d", tt.leds, i, length, 3*size)
+			}
+			checkLeds(t, i, p[ddpHeaderSize:], start, size)
+			start += size
+		}
+	}
+}
+
+func TestWLED(t *testing.T) {
+	tests := []struct {
+		protocol Protocol
+		leds     int
+		drgb     bool
+		sizes    []int
+	}{
+		{DRGB, 480, true, []int{480}},
+		{DRGB, 490, true, []int{490}},
+		{DRGB, 491, false, []int{489, 2}},
+		{DNRGB, 480, false, []int{480}},
+		{DNRGB, 489, false, []int{489}},
+		{DNRGB, 490, false, []int{489, 1}},
+	}
+	for _, tt := range tests {
+		packets := render(t, tt.protocol, tt.leds, len(tt.sizes))
+		start := 0
+		for i, size := range tt.sizes {
+			p := packets[i]
+			if tt.drgb {
+				if p[0] != wledDRGB || p[1] != defaultTimeout {
+					t.Errorf("%d LEDs: header %v", tt.leds, p[:2])
+				}
+				checkLeds(t, i, p[2:], start, size)
+			} else {
+				if p[0] != wledDNRGB || p[1] != defaultTimeout {
+					t.Errorf("%d LEDs, packet %d: header %v", tt.leds, i, p[:2])
+				}
+				if index := int(binary.BigEndian.Uint16(p[2:])); index != start {
+					t.Errorf("%d LEDs, packet %d: start index %d, want %d", tt.leds, i, index, start)
+				}
+				checkLeds(t, i, p[4:], start, size)
+			}
+			start += size
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"sync"
+)
+
+// frameHub distributes the composed frames to the subscribers
+type frameHub struct {
+	mu          sync.Mutex
+	last        *image.RGBA
+	subscribers map[chan *image.RGBA]struct{}
+}
+
+// Subscribe returns a channel receiving the frames composed by the
+// renderer, starting with the current one, and a function canceling the
+// subscription. The frames must not be modified. A slow subscriber skips
+// frames, but the frame it receives next is always the latest one.
+func (tower *TowerRenderer) Subscribe() (<-chan *image.RGBA, func()) {
+	hub := &tower.frames
+	c := make(chan *image.RGBA, 1)
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.subscribers == nil {
+		hub.subscribers = make(map[chan *image.RGBA]struct{})
+	}
+	hub.subscribers[c] = struct{}{}
+	if hub.last != nil {
+		c <- hub.last
+	}
+	cancel := func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		delete(hub.subscribers, c)
+	}
+	return c, cancel
+}
+
+// publish sends a frame to the subscribers. A frame still waiting in the
+// channel of a subscriber is replaced by the new one. Only publish and
+// Subscribe send on the channels, with the lock held, so the send never
+// blocks once the channel is drained.
+func (hub *frameHub) publish(frame *image.RGBA) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.last = frame
+	for c := range hub.subscribers {
+		select {
+		case <-c:
+		default:
+		}
+		c <- frame
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"testing"
+)
+
+func TestSubscribeStartsWithCurrentFrame(t *testing.T) {
+	tower := &TowerRenderer{}
+	current := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	tower.frames.publish(current)
+
+	frames, cancel := tower.Subscribe()
+	defer cancel()
+	if got := <-frames; got != current {
+		t.Errorf("first frame = %p, want the current frame %p", got, current)
+	}
+}
+
+func TestPublishLatestWins(t *testing.T) {
+	tower := &TowerRenderer{}
+	frames, cancel := tower.Subscribe()
+	defer cancel()
+
+	var last *image.RGBA
+	for i := 0; i < 3; i++ {
+		last = image.NewRGBA(image.Rect(0, 0, i+1, 1))
+		tower.frames.publish(last)
+	}
+	if got := <-frames; got != last {
+		t.Errorf("received frame %v, want the latest one %v", got.Bounds(), last.Bounds())
+	}
+	select {
+	case got := <-frames:
+		t.Errorf("received stale frame %v", got.Bounds())
+	default:
+	}
+}
+
+func TestCancelSubscription(t *testing.T) {
+	tower := &TowerRenderer{}
+	frames, cancel := tower.Subscribe()
+	cancel()
+
+	tower.frames.publish(image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	select {
+	case <-frames:
+		t.Error("frame received after cancel")
+	default:
+	}
+}
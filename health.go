@@ -0,0 +1,187 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultMinBackoff  = 100 * time.Millisecond
+	defaultMaxBackoff  = 5 * time.Second
+	defaultReinitAfter = 5
+)
+
+// HealthState is the state of the engines of a renderer
+type HealthState int
+
+// Health states
+const (
+	// EngineUninitialized means that the engines are not initialized yet,
+	// or are finalized
+	EngineUninitialized HealthState = iota
+	// EngineHealthy means that the last frame was displayed
+	EngineHealthy
+	// EngineFailing means that the engines failed to initialize or to
+	// display the last frame
+	EngineFailing
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case EngineUninitialized:
+		return "uninitialized"
+	case EngineHealthy:
+		return "healthy"
+	case EngineFailing:
+		return "failing"
+	}
+	return "unknown"
+}
+
+// RecoveryPolicy defines how the renderer recovers when the engines fail
+// to display a frame
+type RecoveryPolicy struct {
+	// MinBackoff is the delay before retrying a failed frame (default
+	// 100ms). It doubles after each consecutive failure.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay between two retries (default 5s)
+	MaxBackoff time.Duration
+	// ReinitAfter is the number of consecutive failures after which the
+	// engines are finalized and initialized again (default 5). A negative
+	// value disables it.
+	ReinitAfter int
+}
+
+// healthMonitor holds the health state of the engines
+type healthMonitor struct {
+	mu      sync.Mutex
+	state   HealthState
+	err     error
+	watcher func(HealthState) // called when the state is set
+}
+
+func (hm *healthMonitor) set(state HealthState, err error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.state = state
+	hm.err = err
+	if hm.watcher != nil {
+		hm.watcher(state)
+	}
+}
+
+// watch calls f with the current state and each time the state is set
+func (hm *healthMonitor) watch(f func(HealthState)) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.watcher = f
+	f(hm.state)
+}
+
+// registerHealth registers the standard gRPC health service, which
+// reports the health of the engines
+func (tower *TowerRenderer) registerHealth(grpcServer *grpc.Server) *grpchealth.Server {
+	hs := grpchealth.NewServer()
+	tower.health.watch(func(state HealthState) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if state == EngineHealthy {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		hs.SetServingStatus("", status)
+	})
+	healthpb.RegisterHealthServer(grpcServer, hs)
+	return hs
+}
+
+// Health returns the state of the engines and the last error if they are
+// failing
+func (tower *TowerRenderer) Health() (HealthState, error) {
+	hm := &tower.health
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	return hm.state, hm.err
+}
+
+// recovery tracks the failures of the render loop
+type recovery struct {
+	policy   RecoveryPolicy
+	failures int              // consecutive failures
+	next     time.Time        // time of the next retry
+	retry    <-chan time.Time // signals the next retry, nil if healthy
+}
+
+// waiting returns true if a failed frame waits for its retry
+func (rec *recovery) waiting() bool {
+	return rec.retry != nil && time.Now().Before(rec.next)
+}
+
+// display renders the layers and returns true if they were displayed. If
+// the engines fail, the frame is retried with an exponential backoff: the
+// frames coming earlier are skipped and rec.retry signals when the loop
+// must display the frame again.
+func (tower *TowerRenderer) display(ls layersSet, rec *recovery) bool {
+	if rec.waiting() {
+		return false
+	}
+	err := tower.renderLed(ls)
+	if err == nil {
+		if rec.failures > 0 {
+			log.Infof("Engine recovered after %d failure(s)", rec.failures)
+			tower.health.set(EngineHealthy, nil)
+		}
+		rec.failures = 0
+		rec.retry = nil
+		return true
+	}
+
+	rec.failures++
+	tower.metrics.renderErrors.Inc()
+	log.Errorf("Failed to display frame (%d consecutive failure(s)): %v", rec.failures, err)
+	tower.health.set(EngineFailing, err)
+	if rec.policy.ReinitAfter > 0 && rec.failures%rec.policy.ReinitAfter == 0 {
+		tower.reinit()
+	}
+	backoff := rec.policy.MinBackoff
+	for i := 1; i < rec.failures && backoff < rec.policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > rec.policy.MaxBackoff {
+		backoff = rec.policy.MaxBackoff
+	}
+	rec.next = time.Now().Add(backoff)
+	rec.retry = time.After(backoff)
+	return false
+}
+
+// reinit finalizes and initializes the engines again
+func (tower *TowerRenderer) reinit() {
+	log.Warn("Reinitializing engines")
+	for _, engine := range tower.engines {
+		engine.Fini()
+	}
+	for _, engine := range tower.engines {
+		if err := engine.Init(); err != nil {
+			log.Errorf("Failed to reinitialize engine: %v", err)
+			tower.health.set(EngineFailing, err)
+		}
+	}
+}
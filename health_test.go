@@ -0,0 +1,120 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// failingEngine fails to render its first frames
+type failingEngine struct {
+	failures int
+	renders  int
+	inits    int
+	finis    int
+}
+
+func (e *failingEngine) Init() error                     { e.inits++; return nil }
+func (e *failingEngine) Fini()                           { e.finis++ }
+func (e *failingEngine) Wait() error                     { return nil }
+func (e *failingEngine) SetLedsSync(int, []uint32) error { return nil }
+
+func (e *failingEngine) Render() error {
+	e.renders++
+	if e.renders <= e.failures {
+		return errors.New("render failed")
+	}
+	return nil
+}
+
+func TestDisplayRecovery(t *testing.T) {
+	const minBackoff = 10 * time.Millisecond
+	const maxBackoff = 40 * time.Millisecond
+	tests := []struct {
+		failures    int
+		reinitAfter int
+		backoffs    []time.Duration // delay before the retry of each failure
+		reinits     int
+	}{
+		{
+			failures:    1,
+			reinitAfter: 3,
+			backoffs:    []time.Duration{minBackoff},
+		},
+		{
+			failures:    7,
+			reinitAfter: 3,
+			backoffs: []time.Duration{
+				minBackoff, 2 * minBackoff, maxBackoff, maxBackoff, maxBackoff, maxBackoff, maxBackoff,
+			},
+			reinits: 2,
+		},
+		{
+			failures:    4,
+			reinitAfter: -1,
+			backoffs:    []time.Duration{minBackoff, 2 * minBackoff, maxBackoff, maxBackoff},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("failures=%d/reinitAfter=%d", tt.failures, tt.reinitAfter), func(t *testing.T) {
+			engine := &failingEngine{failures: tt.failures}
+			tower := NewRenderer(engine, Config{Width: 4, Height: 1, Layers: 1, Recovery: RecoveryPolicy{
+				MinBackoff:  minBackoff,
+				MaxBackoff:  maxBackoff,
+				ReinitAfter: tt.reinitAfter,
+			}})
+			tower.health.set(EngineHealthy, nil)
+			rec := &recovery{policy: tower.config.Recovery}
+
+			for i, backoff := range tt.backoffs {
+				before := time.Now()
+				if tower.display(nil, rec) {
+					t.Fatalf("failure %d: frame displayed", i+1)
+				}
+				after := time.Now()
+				if state, err := tower.Health(); state != EngineFailing || err == nil {
+					t.Errorf("failure %d: health %v (%v), want %v", i+1, state, err, EngineFailing)
+				}
+				if rec.next.Before(before.Add(backoff)) || rec.next.After(after.Add(backoff)) {
+					t.Errorf("failure %d: retry in %v, want %v", i+1, rec.next.Sub(before), backoff)
+				}
+				// the frames are skipped until the retry
+				renders := engine.renders
+				if tower.display(nil, rec) || engine.renders != renders {
+					t.Errorf("failure %d: frame rendered before the retry", i+1)
+				}
+				rec.next = time.Now()
+			}
+
+			if !tower.display(nil, rec) {
+				t.Fatal("frame not displayed after the failures")
+			}
+			if state, err := tower.Health(); state != EngineHealthy || err != nil {
+				t.Errorf("health %v (%v) after recovery, want %v", state, err, EngineHealthy)
+			}
+			if rec.failures != 0 || rec.retry != nil {
+				t.Errorf("recovery not reset: %d failures", rec.failures)
+			}
+			if engine.inits != tt.reinits || engine.finis != tt.reinits {
+				t.Errorf("%d inits and %d finis, want %d reinitializations",
+					engine.inits, engine.finis, tt.reinits)
+			}
+		})
+	}
+}
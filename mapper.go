@@ -0,0 +1,151 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PixelMapper maps the coordinates of a pixel of the display to the index
+// of the LED wired at this position
+type PixelMapper interface {
+	// Index returns the index of the LED at (x, y) or -1 if there is none
+	Index(x, y int) int
+	// Len returns the number of LEDs on the strip
+	Len() int
+}
+
+// Corner is the position of the first LED of a panel
+type Corner int
+
+// The four corners of a panel
+const (
+	TopLeft Corner = iota
+	TopRight
+	BottomLeft
+	BottomRight
+)
+
+// MatrixMapper maps the pixels of a panel wired as a regular matrix. The
+// strip runs along the columns (or along the rows if RowMajor is set),
+// starting at the Origin corner. If Serpentine is set, every other
+// column (row) runs in the opposite direction.
+type MatrixMapper struct {
+	Width      int
+	Height     int
+	RowMajor   bool
+	Serpentine bool
+	Origin     Corner
+}
+
+// Index implements the PixelMapper interface
+func (m *MatrixMapper) Index(x, y int) int {
+	if x < 0 || x >= m.Width || y < 0 || y >= m.Height {
+		return -1
+	}
+	if m.Origin == TopRight || m.Origin == BottomRight {
+		x = m.Width - 1 - x
+	}
+	if m.Origin == BottomLeft || m.Origin == BottomRight {
+		y = m.Height - 1 - y
+	}
+	major, minor, minorLen := x, y, m.Height
+	if m.RowMajor {
+		major, minor, minorLen = y, x, m.Width
+	}
+	if m.Serpentine && major%2 != 0 {
+		minor = minorLen - 1 - minor
+	}
+	return major*minorLen + minor
+}
+
+// Len implements the PixelMapper interface
+func (m *MatrixMapper) Len() int {
+	return m.Width * m.Height
+}
+
+// LookupTableMapper maps the pixels using an explicit table. The table
+// is indexed by [y][x] and negative values mark pixels without LED.
+type LookupTableMapper struct {
+	table [][]int
+	len   int
+}
+
+// NewLookupTableMapper returns a mapper using the given table
+func NewLookupTableMapper(table [][]int) *LookupTableMapper {
+	m := &LookupTableMapper{table: table}
+	for _, row := range table {
+		for _, index := range row {
+			if index+1 > m.len {
+				m.len = index + 1
+			}
+		}
+	}
+	return m
+}
+
+// LoadLookupTableMapper reads a lookup table from a text file. Each line of
+// the file describes a row of the display and contains the whitespace
+// separated LED indexes of its pixels. Empty lines and lines starting with
+// '#' are ignored.
+func LoadLookupTableMapper(filename string) (*LookupTableMapper, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Error opening lookup table")
+	}
+	defer f.Close() // nolint: errcheck
+
+	var table [][]int
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		row := make([]int, len(fields))
+		for i, field := range fields {
+			row[i], err = strconv.Atoi(field)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid index at line %d", lineNo)
+			}
+		}
+		table = append(table, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessage(err, "Error reading lookup table")
+	}
+	return NewLookupTableMapper(table), nil
+}
+
+// Index implements the PixelMapper interface
+func (m *LookupTableMapper) Index(x, y int) int {
+	if y < 0 || y >= len(m.table) || x < 0 || x >= len(m.table[y]) {
+		return -1
+	}
+	return m.table[y][x]
+}
+
+// Len implements the PixelMapper interface
+func (m *LookupTableMapper) Len() int {
+	return m.len
+}
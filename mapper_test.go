@@ -0,0 +1,147 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// stripOrder returns the pixels of a panel in the order of the strip,
+// walking the columns (rows) from the origin corner
+func stripOrder(m MatrixMapper) []image.Point {
+	majorLen, minorLen := m.Width, m.Height
+	if m.RowMajor {
+		majorLen, minorLen = m.Height, m.Width
+	}
+	var res []image.Point
+	for major := 0; major < majorLen; major++ {
+		for i := 0; i < minorLen; i++ {
+			minor := i
+			if m.Serpentine && major%2 != 0 {
+				minor = minorLen - 1 - i
+			}
+			p := image.Pt(major, minor)
+			if m.RowMajor {
+				p = image.Pt(minor, major)
+			}
+			if m.Origin == TopRight || m.Origin == BottomRight {
+				p.X = m.Width - 1 - p.X
+			}
+			if m.Origin == BottomLeft || m.Origin == BottomRight {
+				p.Y = m.Height - 1 - p.Y
+			}
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func TestMatrixMapper(t *testing.T) {
+	for _, origin := range []Corner{TopLeft, TopRight, BottomLeft, BottomRight} {
+		for _, rowMajor := range []bool{false, true} {
+			for _, serpentine := range []bool{false, true} {
+				m := MatrixMapper{Width: 5, Height: 3, RowMajor: rowMajor, Serpentine: serpentine, Origin: origin}
+				if m.Len() != 15 {
+					t.Fatalf("%+v: Len() = %d", m, m.Len())
+				}
+				for i, p := range stripOrder(m) {
+					if index := m.Index(p.X, p.Y); index != i {
+						t.Errorf("%+v: Index(%d, %d) = %d, want %d", m, p.X, p.Y, index, i)
+					}
+				}
+				for _, p := range []image.Point{{-1, 0}, {5, 0}, {0, -1}, {0, 3}} {
+					if index := m.Index(p.X, p.Y); index != -1 {
+						t.Errorf("%+v: Index(%d, %d) = %d, want -1", m, p.X, p.Y, index)
+					}
+				}
+			}
+		}
+	}
+}
+
+// The default mapper is the wiring of the telecom tower: the strip runs
+// along the columns, odd columns from bottom to top.
+func TestMatrixMapperTowerWiring(t *testing.T) {
+	const w, h = 128, 8
+	m := MatrixMapper{Width: w, Height: h, Serpentine: true}
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			want := x*h + y
+			if x%2 != 0 {
+				want = x*h + h - 1 - y
+			}
+			if index := m.Index(x, y); index != want {
+				t.Fatalf("Index(%d, %d) = %d, want %d", x, y, index, want)
+			}
+		}
+	}
+}
+
+func TestLoadLookupTableMapper(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+		table   [][]int
+		len     int
+	}{
+		{
+			name:    "valid",
+			content: "# a 3x2 panel\n\n0 1 -1\n  4 3\t2\n",
+			table:   [][]int{{0, 1, -1}, {4, 3, 2}},
+			len:     5,
+		},
+		{name: "empty", content: "# nothing\n"},
+		{name: "not a number", content: "0 1\n2 x\n", wantErr: true},
+		{name: "float", content: "0 1.5\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "table.txt")
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			m, err := LoadLookupTableMapper(filename)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if m.Len() != tt.len {
+				t.Errorf("Len() = %d, want %d", m.Len(), tt.len)
+			}
+			for y, row := range tt.table {
+				for x, want := range row {
+					if index := m.Index(x, y); index != want {
+						t.Errorf("Index(%d, %d) = %d, want %d", x, y, index, want)
+					}
+				}
+			}
+			if index := m.Index(0, len(tt.table)); index != -1 {
+				t.Errorf("Index below the table = %d, want -1", index)
+			}
+		})
+	}
+}
+
+func TestLoadLookupTableMapperMissingFile(t *testing.T) {
+	if _, err := LoadLookupTableMapper(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("no error for a missing file")
+	}
+}
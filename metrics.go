@@ -0,0 +1,186 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	pb "github.com/telecom-tower/towerapi/v1"
+	"google.golang.org/grpc/status"
+)
+
+const metricsNamespace = "tower"
+
+// metrics are the Prometheus metrics of a renderer. They are always
+// updated and exported once registered with RegisterMetrics.
+type metrics struct {
+	frames        prometheus.Counter
+	droppedFrames prometheus.Counter
+	renderErrors  prometheus.Counter
+	composition   prometheus.Histogram
+	setLeds       prometheus.Histogram
+	activeLayers  prometheus.Gauge
+	rollingQueue  *prometheus.GaugeVec
+	drawStreams   prometheus.Gauge
+	requests      *prometheus.CounterVec
+	requestErrors *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	// from 100µs to 200ms
+	latencyBuckets := prometheus.ExponentialBuckets(0.0001, 2, 12)
+	return &metrics{
+		frames: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "frames_rendered_total",
+			Help:      "Number of frames sent to the engines.",
+		}),
+		droppedFrames: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "frames_dropped_total",
+			Help:      "Number of animation frames skipped because the renderer was late.",
+		}),
+		renderErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "render_errors_total",
+			Help:      "Number of frames the engines failed to display.",
+		}),
+		composition: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "frame_composition_seconds",
+			Help:      "Time to compose the layers and map them to the LEDs.",
+			Buckets:   latencyBuckets,
+		}),
+		setLeds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "set_leds_seconds",
+			Help:      "Time to send the LEDs of a channel to its engine.",
+			Buckets:   latencyBuckets,
+		}),
+		activeLayers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_layers",
+			Help:      "Number of layers displayed.",
+		}),
+		rollingQueue: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "rolling_queue_length",
+			Help:      "Number of images queued in a rolling layer.",
+		}, []string{"layer"}),
+		drawStreams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "draw_streams",
+			Help:      "Number of Draw streams in flight.",
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "draw_requests_total",
+			Help:      "Number of drawing requests by type.",
+		}, []string{"type"}),
+		requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "draw_request_errors_total",
+			Help:      "Number of rejected drawing requests by type and status code.",
+		}, []string{"type", "code"}),
+	}
+}
+
+func (m *metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.frames,
+		m.droppedFrames,
+		m.renderErrors,
+		m.composition,
+		m.setLeds,
+		m.activeLayers,
+		m.rollingQueue,
+		m.drawStreams,
+		m.requests,
+		m.requestErrors,
+	}
+}
+
+// rollingQueueGauges returns the gauges of the rolling queues of the
+// layers
+func (m *metrics) rollingQueueGauges(layers int) []prometheus.Gauge {
+	gauges := make([]prometheus.Gauge, layers)
+	for i := range gauges {
+		gauges[i] = m.rollingQueue.WithLabelValues(strconv.Itoa(i))
+	}
+	return gauges
+}
+
+// request counts a drawing request and its error, if any
+func (m *metrics) request(name string, err error) {
+	m.requests.WithLabelValues(name).Inc()
+	if err != nil {
+		m.requestErrors.WithLabelValues(name, status.Code(err).String()).Inc()
+	}
+}
+
+// requestName returns the name of the type of a drawing request
+func requestName(req *pb.DrawRequest) string {
+	switch req.Type.(type) {
+	case *pb.DrawRequest_Init:
+		return "init"
+	case *pb.DrawRequest_Clear:
+		return "clear"
+	case *pb.DrawRequest_SetPixels:
+		return "set_pixels"
+	case *pb.DrawRequest_DrawRectangle:
+		return "draw_rectangle"
+	case *pb.DrawRequest_DrawBitmap:
+		return "draw_bitmap"
+	case *pb.DrawRequest_WriteText:
+		return "write_text"
+	case *pb.DrawRequest_SetLayerOrigin:
+		return "set_layer_origin"
+	case *pb.DrawRequest_SetLayerAlpha:
+		return "set_layer_alpha"
+	case *pb.DrawRequest_AutoRoll:
+		return "auto_roll"
+	}
+	return "unknown"
+}
+
+// RegisterMetrics registers the metrics of the renderer with reg
+func (tower *TowerRenderer) RegisterMetrics(reg prometheus.Registerer) error {
+	for _, c := range tower.metrics.collectors() {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetricsHandler returns an HTTP handler exporting the metrics of the
+// renderer and of the Go runtime
+func (tower *TowerRenderer) MetricsHandler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tower.metrics.collectors()...)
+	reg.MustRegister(collectors.NewGoCollector())
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// ServeMetrics serves the metrics of the renderer on addr at /metrics
+func (tower *TowerRenderer) ServeMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", tower.MetricsHandler())
+	return http.ListenAndServe(addr, mux)
+}
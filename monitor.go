@@ -0,0 +1,134 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+)
+
+// maxWatchFPS is the maximum frame rate a client of WatchFrames may ask
+const maxWatchFPS = 1000
+
+// WatchFrames streams the frames composed by the renderer. With MaxFps,
+// frames arriving faster are dropped and only the latest one is sent.
+// With Delta, only the first frame is complete (Keyframe) and the
+// following ones contain the pixels changed since the previous frame sent
+// (unless the complete frame is smaller).
+func (tower *TowerRenderer) WatchFrames(req *api.WatchFramesRequest, stream api.TowerControl_WatchFramesServer) error {
+	log.Debugf("Watch frames (max fps: %v, delta: %v)", req.MaxFps, req.Delta)
+	if req.MaxFps > maxWatchFPS {
+		return invalidArgument("max fps %d out of range [0, %d]", req.MaxFps, maxWatchFPS)
+	}
+	frames, cancel := tower.Subscribe()
+	defer cancel()
+
+	var tick <-chan time.Time
+	if req.MaxFps > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(req.MaxFps))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var previous, pending *image.RGBA
+	var sequence uint64
+	send := func(frame *image.RGBA) error {
+		sequence++
+		var msg *api.Frame
+		if req.Delta && previous != nil && previous.Bounds().Eq(frame.Bounds()) {
+			msg = deltaFrame(previous, frame)
+		} else {
+			msg = keyFrame(frame)
+		}
+		msg.Sequence = sequence
+		previous = frame
+		return stream.Send(msg)
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-tower.closing:
+			return nil
+		case frame := <-frames:
+			if tick != nil {
+				pending = frame
+				continue
+			}
+			if err := send(frame); err != nil {
+				return err
+			}
+		case <-tick:
+			if pending == nil {
+				continue
+			}
+			if err := send(pending); err != nil {
+				return err
+			}
+			pending = nil
+		}
+	}
+}
+
+func keyFrame(frame *image.RGBA) *api.Frame {
+	bounds := frame.Bounds()
+	rgb := make([]byte, 0, 3*bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := frame.RGBAAt(x, y)
+			rgb = append(rgb, c.R, c.G, c.B)
+		}
+	}
+	return &api.Frame{
+		Width:    uint32(bounds.Dx()),
+		Height:   uint32(bounds.Dy()),
+		Keyframe: true,
+		Rgb:      rgb,
+	}
+}
+
+// deltaFrame returns the pixels of frame which differ from previous, or
+// the complete frame if there are too many of them
+func deltaFrame(previous, frame *image.RGBA) *api.Frame {
+	bounds := frame.Bounds()
+	// a changed pixel costs about 4 times more than in a key frame
+	maxChanges := bounds.Dx() * bounds.Dy() / 4
+	var changes []*api.Pixel
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := frame.RGBAAt(x, y)
+			if c == previous.RGBAAt(x, y) {
+				continue
+			}
+			if len(changes) == maxChanges {
+				return keyFrame(frame)
+			}
+			changes = append(changes, &api.Pixel{
+				X:     int32(x),
+				Y:     int32(y),
+				Color: uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B),
+			})
+		}
+	}
+	return &api.Frame{
+		Width:   uint32(bounds.Dx()),
+		Height:  uint32(bounds.Dy()),
+		Changes: changes,
+	}
+}
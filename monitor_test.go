@@ -0,0 +1,83 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeFrameStream cancels its context after the first frame sent
+type fakeFrameStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	frames []*api.Frame
+}
+
+func (s *fakeFrameStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeFrameStream) Send(frame *api.Frame) error {
+	s.frames = append(s.frames, frame)
+	s.cancel()
+	return nil
+}
+
+func TestWatchFramesMaxFps(t *testing.T) {
+	tests := []struct {
+		maxFps uint32
+		code   codes.Code
+	}{
+		{0, codes.Canceled},
+		{maxWatchFPS, codes.Canceled},
+		{maxWatchFPS + 1, codes.InvalidArgument},
+		// the period of the ticker would be 0
+		{2e9, codes.InvalidArgument},
+		{math.MaxUint32, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		tower := NewRenderer(nil, Config{Width: 2, Height: 1})
+		frame := image.NewRGBA(image.Rect(0, 0, 2, 1))
+		frame.SetRGBA(1, 0, color.RGBA{R: 1, G: 2, B: 3, A: 0xff})
+		tower.frames.publish(frame)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := &fakeFrameStream{ctx: ctx, cancel: cancel}
+		err := tower.WatchFrames(&api.WatchFramesRequest{MaxFps: tt.maxFps}, stream)
+		cancel()
+		if tt.code == codes.Canceled {
+			if err != context.Canceled {
+				t.Errorf("max fps %d: error %v, want %v", tt.maxFps, err, context.Canceled)
+			}
+			if len(stream.frames) != 1 || string(stream.frames[0].Rgb) != "\x00\x00\x00\x01\x02\x03" {
+				t.Errorf("max fps %d: frames %v", tt.maxFps, stream.frames)
+			}
+			continue
+		}
+		if code := status.Code(err); code != tt.code {
+			t.Errorf("max fps %d: code %v, want %v", tt.maxFps, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBrightness          = 0xff
+	defaultMilliampsPerChannel = 20
+)
+
+// PowerBudget limits the current drawn by the LEDs. When a frame exceeds
+// the budget, it is dimmed until it fits.
+type PowerBudget struct {
+	// MaxMilliamps is the current available for the LEDs. Zero disables the
+	// limiter.
+	MaxMilliamps float64
+	// MilliampsPerChannel is the current drawn by one color channel of a
+	// LED at full intensity (default 20mA)
+	MilliampsPerChannel float64
+	// IdleMilliamps is the current drawn by a LED when it is off
+	IdleMilliamps float64
+}
+
+// SetBrightness changes the global brightness of the display (0-255)
+func (tower *TowerRenderer) SetBrightness(brightness uint8) {
+	atomic.StoreUint32(&tower.brightness, uint32(brightness))
+}
+
+// Brightness returns the global brightness of the display
+func (tower *TowerRenderer) Brightness() uint8 {
+	return uint8(atomic.LoadUint32(&tower.brightness))
+}
+
+// estimatedMilliamps returns the current drawn by the LEDs of the outputs
+// at full brightness
+func (budget *PowerBudget) estimatedMilliamps(outputs []*channelOutput) (idle float64, active float64) {
+	var sum uint64
+	n := 0
+	for _, out := range outputs {
+		for _, c := range out.leds {
+			sum += uint64((c>>16)&0xff) + uint64((c>>8)&0xff) + uint64(c&0xff)
+		}
+		n += len(out.leds)
+	}
+	idle = float64(n) * budget.IdleMilliamps
+	active = float64(sum) / 0xff * budget.MilliampsPerChannel
+	return idle, active
+}
+
+// dim applies the global brightness to the outputs and scales them down
+// further if the frame exceeds the power budget
+func (tower *TowerRenderer) dim(outputs []*channelOutput) {
+	scale := float64(tower.Brightness()) / 0xff
+	budget := &tower.config.Power
+	if budget.MaxMilliamps > 0 {
+		idle, active := budget.estimatedMilliamps(outputs)
+		if total := idle + active*scale; total > budget.MaxMilliamps {
+			limit := 0.0
+			if active > 0 && budget.MaxMilliamps > idle {
+				limit = (budget.MaxMilliamps - idle) / active
+			}
+			log.Debugf("Frame needs %.0fmA, limiting brightness to %.2f", total, limit)
+			scale = limit
+		}
+	}
+	if scale >= 1 {
+		return
+	}
+	for _, out := range outputs {
+		for i, c := range out.leds {
+			r := uint32(float64((c>>16)&0xff) * scale)
+			g := uint32(float64((c>>8)&0xff) * scale)
+			b := uint32(float64(c&0xff) * scale)
+			out.leds[i] = r<<16 + g<<8 + b<<0
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"testing"
+)
+
+func TestDim(t *testing.T) {
+	tests := []struct {
+		name       string
+		brightness uint8
+		budget     PowerBudget
+		leds       []uint32
+		want       []uint32
+	}{
+		{
+			name:       "full brightness",
+			brightness: 0xff,
+			leds:       []uint32{0xffffff, 0x102030},
+			want:       []uint32{0xffffff, 0x102030},
+		},
+		{
+			name:       "half brightness",
+			brightness: 0x80,
+			leds:       []uint32{0xffffff, 0x102030},
+			want:       []uint32{0x808080, 0x081018},
+		},
+		{
+			name:       "within the budget",
+			brightness: 0xff,
+			budget:     PowerBudget{MaxMilliamps: 120, MilliampsPerChannel: 20},
+			leds:       []uint32{0xffffff, 0xffffff},
+			want:       []uint32{0xffffff, 0xffffff},
+		},
+		{
+			name:       "over the budget",
+			brightness: 0xff,
+			budget:     PowerBudget{MaxMilliamps: 60, MilliampsPerChannel: 20},
+			leds:       []uint32{0xffffff, 0xffffff},
+			want:       []uint32{0x7f7f7f, 0x7f7f7f},
+		},
+		{
+			name:       "idle current",
+			brightness: 0xff,
+			budget:     PowerBudget{MaxMilliamps: 62, MilliampsPerChannel: 20, IdleMilliamps: 1},
+			leds:       []uint32{0xffffff, 0xffffff},
+			want:       []uint32{0x7f7f7f, 0x7f7f7f},
+		},
+		{
+			name:       "budget below the idle current",
+			brightness: 0xff,
+			budget:     PowerBudget{MaxMilliamps: 1, MilliampsPerChannel: 20, IdleMilliamps: 1},
+			leds:       []uint32{0xffffff, 0xffffff},
+			want:       []uint32{0, 0},
+		},
+		{
+			name:       "dimmed below the budget",
+			brightness: 0x40,
+			budget:     PowerBudget{MaxMilliamps: 60, MilliampsPerChannel: 20},
+			leds:       []uint32{0xffffff, 0xffffff},
+			want:       []uint32{0x404040, 0x404040},
+		},
+	}
+	for _, tt := range tests {
+		tower := NewRenderer(nil, Config{Power: tt.budget})
+		tower.SetBrightness(tt.brightness)
+		out := &channelOutput{leds: append([]uint32(nil), tt.leds...)}
+		tower.dim([]*channelOutput{out})
+		if !equalLeds(out.leds, tt.want) {
+			t.Errorf("%s: LEDs %x, want %x", tt.name, out.leds, tt.want)
+		}
+	}
+}
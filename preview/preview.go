@@ -0,0 +1,206 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package preview implements an HTTP server showing the display of a
+// renderer live in a browser. The frames are streamed over a WebSocket
+// as binary messages: the width and the height (2 bytes each, big
+// endian) followed by the RGB values of the pixels, row by row.
+package preview
+
+import (
+	"encoding/binary"
+	"image"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	renderer "github.com/telecom-tower/grpc-renderer"
+)
+
+const (
+	defaultMaxFPS = 10
+	maxMaxFPS     = 1000
+	writeTimeout  = 5 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// Handler serves the preview page on "/" and the frames on "/ws"
+type Handler struct {
+	tower  *renderer.TowerRenderer
+	period time.Duration
+	mux    *http.ServeMux
+}
+
+// NewHandler returns a handler previewing the display of tower. Each
+// client receives at most maxFPS frames per second (default 10, at most
+// 1000).
+func NewHandler(tower *renderer.TowerRenderer, maxFPS int) *Handler {
+	if maxFPS <= 0 {
+		maxFPS = defaultMaxFPS
+	}
+	if maxFPS > maxMaxFPS {
+		maxFPS = maxMaxFPS
+	}
+	h := &Handler{
+		tower:  tower,
+		period: time.Second / time.Duration(maxFPS),
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/", h.page)
+	h.mux.HandleFunc("/ws", h.stream)
+	return h
+}
+
+// ListenAndServe starts a preview server on addr
+func ListenAndServe(addr string, tower *renderer.TowerRenderer, maxFPS int) error {
+	log.Infof("Preview server running at %v", addr)
+	return http.ListenAndServe(addr, NewHandler(tower, maxFPS))
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(page))
+}
+
+// stream sends the frames to a client, at most one per period. Frames
+// arriving faster are dropped, only the latest one is sent.
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debugf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close() // nolint: errcheck
+
+	// the client never sends anything, reading detects the disconnection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	frames, cancel := h.tower.Subscribe()
+	defer cancel()
+	ticker := time.NewTicker(h.period)
+	defer ticker.Stop()
+	var pending *image.RGBA
+	for {
+		select {
+		case <-closed:
+			return
+		case pending = <-frames:
+		case <-ticker.C:
+			if pending == nil {
+				continue
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(websocket.BinaryMessage, encode(pending)); err != nil {
+				log.Debugf("Preview client gone: %v", err)
+				return
+			}
+			pending = nil
+		}
+	}
+}
+
+// encode returns the message of a frame
+func encode(frame *image.RGBA) []byte {
+	bounds := frame.Bounds()
+	msg := make([]byte, 4, 4+3*bounds.Dx()*bounds.Dy())
+	binary.BigEndian.PutUint16(msg[0:], uint16(bounds.Dx()))
+	binary.BigEndian.PutUint16(msg[2:], uint16(bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := frame.RGBAAt(x, y)
+			msg = append(msg, c.R, c.G, c.B)
+		}
+	}
+	return msg
+}
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Telecom Tower</title>
+<style>
+  body { margin: 0; background: #111; color: #888; font-family: sans-serif; }
+  canvas { display: block; width: 96vw; margin: 2vw auto; background: #000; }
+  #status { text-align: center; }
+</style>
+</head>
+<body>
+<canvas id="display"></canvas>
+<div id="status">connecting...</div>
+<script>
+var canvas = document.getElementById("display");
+var ctx = canvas.getContext("2d");
+var statusLine = document.getElementById("status");
+var dot = 10;
+
+function draw(data) {
+  var view = new DataView(data);
+  var w = view.getUint16(0), h = view.getUint16(2);
+  if (canvas.width != w * dot || canvas.height != h * dot) {
+    canvas.width = w * dot;
+    canvas.height = h * dot;
+  }
+  ctx.fillStyle = "#000";
+  ctx.fillRect(0, 0, canvas.width, canvas.height);
+  var i = 4;
+  for (var y = 0; y < h; y++) {
+    for (var x = 0; x < w; x++) {
+      ctx.fillStyle = "rgb(" + view.getUint8(i) + "," + view.getUint8(i+1) + "," + view.getUint8(i+2) + ")";
+      ctx.beginPath();
+      ctx.arc((x + 0.5) * dot, (y + 0.5) * dot, dot * 0.45, 0, 2 * Math.PI);
+      ctx.fill();
+      i += 3;
+    }
+  }
+}
+
+function connect() {
+  var proto = location.protocol == "https:" ? "wss:" : "ws:";
+  var ws = new WebSocket(proto + "//" + location.host + "/ws");
+  ws.binaryType = "arraybuffer";
+  ws.onopen = function() { statusLine.textContent = "live"; };
+  ws.onmessage = function(e) { draw(e.data); };
+  ws.onclose = function() {
+    statusLine.textContent = "disconnected, retrying...";
+    setTimeout(connect, 2000);
+  };
+}
+connect();
+</script>
+</body>
+</html>
+`
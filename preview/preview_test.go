@@ -0,0 +1,39 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preview
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewHandlerPeriod(t *testing.T) {
+	tests := []struct {
+		maxFPS int
+		period time.Duration
+	}{
+		{0, time.Second / defaultMaxFPS},
+		{-1, time.Second / defaultMaxFPS},
+		{25, 40 * time.Millisecond},
+		{maxMaxFPS, time.Millisecond},
+		// a larger rate would give a zero period and crash the ticker
+		{2e9, time.Millisecond},
+	}
+	for _, tt := range tests {
+		if h := NewHandler(nil, tt.maxFPS); h.period != tt.period {
+			t.Errorf("max fps %d: period %v, want %v", tt.maxFPS, h.period, tt.period)
+		}
+	}
+}
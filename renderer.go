@@ -23,19 +23,21 @@ import (
 	"image"
 	"image/color"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/telecom-tower/sdk"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
 	pb "github.com/telecom-tower/towerapi/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
-)
-
-const (
-	displayHeight = 8
-	displayWidth  = 128
-	maxLayers     = 8
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/reflection"
 )
 
 // WsEngine is an interface to a ws281x "NeoPixel" device
@@ -49,11 +51,16 @@ type WsEngine interface {
 }
 
 type rolling struct {
-	mode      int
-	entry     int
-	separator int
-	last      int
-	wrap      *image.RGBA
+	mode       int
+	entry      int
+	separator  int
+	direction  int
+	speed      float64       // pixels per second, 0 means one pixel per frame
+	pause      time.Duration // pause each time a line is aligned with the display
+	lineHeight int           // size of a line, 0 means the size of the display
+	last       int
+	cycle      int // length of the repeated body and separator
+	wrap       *image.RGBA
 }
 
 type layer struct {
@@ -67,12 +74,27 @@ type layer struct {
 
 type layersSet []*layer
 
-// TowerRenderer is the base type for rendering
+// TowerRenderer is the base type for rendering. It is safe to draw on it
+// from several concurrent streams.
 type TowerRenderer struct {
+	mu           sync.Mutex // protects layers, activeLayers, lsc and started
 	ws           WsEngine
+	config       Config
+	segments     []boundSegment
+	outputs      []*channelOutput
+	engines      []WsEngine
+	colors       *colorPipeline
+	brightness   uint32 // accessed atomically
+	frames       frameHub
+	health       healthMonitor
+	healthServer *grpchealth.Server
+	metrics      *metrics
 	layers       layersSet
 	activeLayers []bool
-	lsc          chan layersSet
+	lsc          chan layersUpdate // nil when the loop is not running
+	loopDone     chan struct{}     // closed when the loop ends
+	closing      chan struct{}     // closed when the server shuts down
+	started      bool              // a renderer is served only once
 }
 
 func combineOver(bg color.Color, fg color.Color) color.Color {
@@ -89,10 +111,12 @@ func combineOver(bg color.Color, fg color.Color) color.Color {
 	}
 }
 
-// NewRenderer returns a new TowerRenderer instance
-func NewRenderer(ws WsEngine) *TowerRenderer {
-	layers := make([]*layer, maxLayers)
-	activeLayers := make([]bool, maxLayers)
+// NewRenderer returns a new TowerRenderer instance. Unset fields of the
+// configuration take the values of DefaultConfig.
+func NewRenderer(ws WsEngine, config Config) *TowerRenderer {
+	config = config.normalized()
+	layers := make([]*layer, config.Layers)
+	activeLayers := make([]bool, config.Layers)
 	for i := 0; i < len(layers); i++ {
 		layers[i] = &layer{
 			image:  image.NewRGBA(image.Rect(0, 0, 0, 0)),
@@ -101,10 +125,19 @@ func NewRenderer(ws WsEngine) *TowerRenderer {
 		}
 		activeLayers[i] = false
 	}
+	segments, outputs, engines := bindSegments(ws, config.Segments)
 	return &TowerRenderer{
 		ws:           ws,
+		config:       config,
+		segments:     segments,
+		outputs:      outputs,
+		engines:      engines,
+		colors:       newColorPipeline(config.Color),
+		brightness:   uint32(config.Brightness),
 		layers:       layers,
 		activeLayers: activeLayers,
+		closing:      make(chan struct{}),
+		metrics:      newMetrics(),
 	}
 }
 
@@ -141,16 +174,20 @@ func paint(img *image.RGBA, x int, y int, c color.Color, mode int) {
 }
 
 // This function is rather complex. I should perhaps refactor it
-func preparedLayer(l *layer) *layer { // nolint: gocyclo
+func preparedLayer(l *layer, displayWidth, displayHeight int) *layer { // nolint: gocyclo
 	log.Debug("Preparing layer")
 	res := &layer{
 		alpha:  0xffff,
 		origin: l.origin,
 		id:     l.id,
 		rolling: rolling{
-			mode:      l.rolling.mode,
-			entry:     l.rolling.entry,
-			separator: l.rolling.separator,
+			mode:       l.rolling.mode,
+			entry:      l.rolling.entry,
+			separator:  l.rolling.separator,
+			direction:  l.rolling.direction,
+			speed:      l.rolling.speed,
+			pause:      l.rolling.pause,
+			lineHeight: l.rolling.lineHeight,
 		},
 	}
 
@@ -158,14 +195,26 @@ func preparedLayer(l *layer) *layer { // nolint: gocyclo
 	bounds := l.image.Bounds()
 	if l.rolling.mode != sdk.RollingStop {
 		dx := l.rolling.entry + l.rolling.separator
-		if bounds.Max.X-dx <= 0 {
-			// make sure that wBody > 0 for rolling frames
-			log.Debugf("Fixing width : %v -> %v", bounds.Max.X-dx, displayWidth+dx)
-			bounds.Max.X = displayWidth + dx
-		}
-		if bounds.Max.Y < displayHeight {
-			log.Debugf("Fixing height : %v -> %v", bounds.Max.Y, displayHeight)
-			bounds.Max.Y = displayHeight
+		if l.rolling.vertical() {
+			if bounds.Max.Y-dx <= 0 {
+				// make sure that wBody > 0 for rolling frames
+				log.Debugf("Fixing height : %v -> %v", bounds.Max.Y-dx, displayHeight+dx)
+				bounds.Max.Y = displayHeight + dx
+			}
+			if bounds.Max.X < displayWidth {
+				log.Debugf("Fixing width : %v -> %v", bounds.Max.X, displayWidth)
+				bounds.Max.X = displayWidth
+			}
+		} else {
+			if bounds.Max.X-dx <= 0 {
+				// make sure that wBody > 0 for rolling frames
+				log.Debugf("Fixing width : %v -> %v", bounds.Max.X-dx, displayWidth+dx)
+				bounds.Max.X = displayWidth + dx
+			}
+			if bounds.Max.Y < displayHeight {
+				log.Debugf("Fixing height : %v -> %v", bounds.Max.Y, displayHeight)
+				bounds.Max.Y = displayHeight
+			}
 		}
 	}
 	img := image.NewRGBA(bounds)
@@ -185,87 +234,165 @@ func preparedLayer(l *layer) *layer { // nolint: gocyclo
 		res.image = img
 	} else {
 		log.Debug("Extending image for rolling")
+		// The extension is computed along the scrolling direction: x (or u)
+		// runs along the direction and y (or v) across it.
+		displayLength, displayBreadth := displayWidth, displayHeight
+		if l.rolling.vertical() {
+			displayLength, displayBreadth = displayHeight, displayWidth
+		}
+		src := newScrollAxis(&l.rolling, img.Bounds())
 		wEntry := l.rolling.entry
 		wSep := l.rolling.separator
-		wBody := img.Bounds().Max.X - wEntry - wSep
-		// find n such that : wBody + n * (wBody + wSep) >= displayWidth
-		// n >= (displayWidth - wBody) / (wBody + wSep)
-		// n = (displayWidth - wBody + wBody + wSep - 1) div (wBody + wSep)
-		// n = (displayWidth + wSep - 1) div (wBody + wSep)
+		wBody := src.length - wEntry - wSep
+		// find n such that : wBody + n * (wBody + wSep) >= displayLength
+		// n >= (displayLength - wBody) / (wBody + wSep)
+		// n = (displayLength - wBody + wBody + wSep - 1) div (wBody + wSep)
+		// n = (displayLength + wSep - 1) div (wBody + wSep)
 
 		// This division should never produce a division by zero. At the beginning of
 		// this function, we ensure that (if we have a rolling frame) wBody > 0
-		nBody := (displayWidth + wSep - 1) / (wBody + wSep)
-		wTot := 2*(displayWidth-1) + wEntry + (nBody+1)*(wBody+wSep)
-		extendedImg := image.NewRGBA(image.Rect(0, 0, wTot, displayHeight))
+		nBody := (displayLength + wSep - 1) / (wBody + wSep)
+		wTot := 2*(displayLength-1) + wEntry + (nBody+1)*(wBody+wSep)
+		dst := scrollAxis{
+			vertical: src.vertical,
+			reversed: src.reversed,
+			length:   wTot,
+		}
+		extendedImg := image.NewRGBA(dst.rect(displayBreadth))
 
 		decisionPoint := wEntry + (nBody+1)*(wBody+wSep) - 1
 		res.rolling.last = decisionPoint
-		for y := 0; y < displayHeight; y++ {
+		res.rolling.cycle = wBody + wSep
+		for y := 0; y < displayBreadth; y++ {
 			// copy prolog if needed
 			if l.rolling.mode == sdk.RollingNext && l.rolling.wrap != nil {
-				for x := 0; x < displayWidth-1; x++ {
-					extendedImg.Set(x, y, l.rolling.wrap.At(x, y))
+				for x := 0; x < displayLength-1; x++ {
+					dst.set(extendedImg, x, y, l.rolling.wrap.At(x, y))
 				}
 			}
 			// copy entry
 			for x := 0; x < wEntry; x++ {
-				extendedImg.Set(x+displayWidth-1, y, img.At(x, y))
+				dst.set(extendedImg, x+displayLength-1, y, src.at(img, x, y))
 			}
 			// Copy extended body and separator
 			for nb := 0; nb < nBody+1; nb++ {
 				for x := 0; x < wBody+wSep; x++ {
-					extendedImg.Set(
-						x+displayWidth-1+wEntry+nb*(wBody+wSep),
+					dst.set(
+						extendedImg,
+						x+displayLength-1+wEntry+nb*(wBody+wSep),
 						y,
-						img.At(x+wEntry, y))
+						src.at(img, x+wEntry, y))
 				}
 			}
 			// Copy the start of the body at the end for a seamless rolling
-			for x := 0; x < displayWidth-1; x++ {
-				extendedImg.Set(
-					x+displayWidth-1+wEntry+(nBody+1)*(wBody+wSep),
+			for x := 0; x < displayLength-1; x++ {
+				dst.set(
+					extendedImg,
+					x+displayLength-1+wEntry+(nBody+1)*(wBody+wSep),
 					y,
-					extendedImg.At(x+displayWidth-1+wEntry, y))
+					dst.at(extendedImg, x+displayLength-1+wEntry, y))
 			}
 		}
-		// compute the wrappring image. No need to do this if mode is CONTINUE
+		// compute the wrappring image. No need to do this if mode is CONTINUE.
+		// The wrap is stored along the scrolling direction (x along, y across).
 		if l.rolling.mode == sdk.RollingStart || l.rolling.mode == sdk.RollingNext {
-			wrap := image.NewRGBA(image.Rect(0, 0, displayWidth-1, displayHeight))
-			for y := 0; y < displayHeight; y++ {
-				for x := 0; x < displayWidth-1; x++ {
-					wrap.Set(x, y, extendedImg.At(x+decisionPoint+1, y))
+			wrap := image.NewRGBA(image.Rect(0, 0, displayLength-1, displayBreadth))
+			for y := 0; y < displayBreadth; y++ {
+				for x := 0; x < displayLength-1; x++ {
+					wrap.Set(x, y, dst.at(extendedImg, x+decisionPoint+1, y))
 				}
 			}
 			// save the wrap in the original layer (not in res)
 			l.rolling.wrap = wrap
 		}
-		res.origin = image.Point{0, 0}
+		res.origin = dst.origin(0, displayLength)
 		res.image = extendedImg
 	}
 	return res
 }
 
-func (tower *TowerRenderer) getLayersSet() layersSet {
+func (tower *TowerRenderer) getLayersSet(ctx context.Context) layersSet {
+	ctx, span := tracer.Start(ctx, "getLayersSet")
+	defer span.End()
 	log.Debug("making layer set")
-	res := make([]*layer, 0, maxLayers)
-	for i := 0; i < maxLayers; i++ {
+	res := make([]*layer, 0, tower.config.Layers)
+	for i := 0; i < tower.config.Layers; i++ {
 		if tower.activeLayers[i] {
 			log.Debug("Building layer")
 			l := tower.layers[i]
 			l.id = i
-			res = append(res, preparedLayer(l))
+			_, span := tracer.Start(ctx, "preparedLayer", trace.WithAttributes(attribute.Int("layer", i)))
+			res = append(res, preparedLayer(l, tower.config.Width, tower.config.Height))
+			span.End()
 		}
 	}
 	return res
 }
 
-// Serve starts a grpc server and handles the requests
-func Serve(listener net.Listener, ws2811 WsEngine, opts ...grpc.ServerOption) error {
+// update sends the active layers to the loop, if it is running. The lock
+// must be held.
+func (tower *TowerRenderer) update(ctx context.Context) {
+	if tower.lsc != nil {
+		tower.lsc <- layersUpdate{ctx: ctx, layers: tower.getLayersSet(ctx)}
+	}
+}
+
+// refresh displays the current layers again, without restarting the
+// rolling layers. The lock must be held.
+func (tower *TowerRenderer) refresh(ctx context.Context) {
+	if tower.lsc != nil {
+		tower.lsc <- layersUpdate{ctx: ctx, refresh: true}
+	}
+}
+
+// Serve starts a grpc server and handles the requests. The engine must
+// be initialized by the caller. Use a Server to manage its life cycle.
+func Serve(listener net.Listener, ws2811 WsEngine, config Config, opts ...grpc.ServerOption) error {
+	return NewRenderer(ws2811, config).Serve(listener, opts...)
+}
+
+// setStarted marks the renderer as served. It fails if it already was:
+// its loop and its closing channel cannot be used twice.
+func (tower *TowerRenderer) setStarted() error {
+	tower.mu.Lock()
+	defer tower.mu.Unlock()
+	if tower.started {
+		return errors.New("renderer already started")
+	}
+	tower.started = true
+	return nil
+}
+
+// start starts the loop, restores the startup scene and returns a grpc
+// server for the renderer
+func (tower *TowerRenderer) start(opts ...grpc.ServerOption) *grpc.Server {
+	if tower.config.Auth != nil {
+		opts = append(opts, tower.config.Auth.ServerOptions()...)
+	}
 	grpcServer := grpc.NewServer(opts...)
-	tower := NewRenderer(ws2811)
-	tower.lsc = tower.loop()
+	lsc := tower.loop()
+	tower.mu.Lock()
+	tower.lsc = lsc
+	tower.mu.Unlock()
+	if err := tower.restoreStartupScene(); err != nil {
+		log.Error(err)
+	}
 	pb.RegisterTowerDisplayServer(grpcServer, tower)
+	api.RegisterTowerControlServer(grpcServer, towerControl{tower})
+	tower.healthServer = tower.registerHealth(grpcServer)
+	if tower.config.Reflection {
+		reflection.Register(grpcServer)
+	}
+	return grpcServer
+}
+
+// Serve starts a grpc server and handles the requests with the renderer
+func (tower *TowerRenderer) Serve(listener net.Listener, opts ...grpc.ServerOption) error {
+	if err := tower.setStarted(); err != nil {
+		return err
+	}
+	tower.health.set(EngineHealthy, nil)
+	grpcServer := tower.start(opts...)
 	log.Infof("Telecom Tower Server running at %v\n", listener.Addr().String())
 	err := grpcServer.Serve(listener)
 	if err != nil {
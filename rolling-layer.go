@@ -1,34 +1,183 @@
 package renderer
 
 import (
+	"image"
+	"image/color"
+
 	log "github.com/sirupsen/logrus"
 )
 
+// Scrolling directions of a rolling layer
+const (
+	rollingLeft = iota
+	rollingRight
+	rollingUp
+	rollingDown
+)
+
+func (r *rolling) vertical() bool {
+	return r.direction == rollingUp || r.direction == rollingDown
+}
+
+func (r *rolling) reversed() bool {
+	return r.direction == rollingRight || r.direction == rollingDown
+}
+
+// scrollAxis maps coordinates along (u) and across (v) the scrolling
+// direction to image coordinates. The image starts at u = 0 and has the
+// given length along the axis.
+type scrollAxis struct {
+	vertical bool
+	reversed bool
+	length   int
+}
+
+func newScrollAxis(r *rolling, bounds image.Rectangle) scrollAxis {
+	a := scrollAxis{
+		vertical: r.vertical(),
+		reversed: r.reversed(),
+		length:   bounds.Max.X,
+	}
+	if a.vertical {
+		a.length = bounds.Max.Y
+	}
+	return a
+}
+
+func (a scrollAxis) point(u, v int) image.Point {
+	if a.reversed {
+		u = a.length - 1 - u
+	}
+	if a.vertical {
+		return image.Point{X: v, Y: u}
+	}
+	return image.Point{X: u, Y: v}
+}
+
+func (a scrollAxis) at(img image.Image, u, v int) color.Color {
+	p := a.point(u, v)
+	return img.At(p.X, p.Y)
+}
+
+func (a scrollAxis) set(img *image.RGBA, u, v int, c color.Color) {
+	p := a.point(u, v)
+	img.Set(p.X, p.Y, c)
+}
+
+// rect returns the bounds of an image of the axis length and the given
+// breadth
+func (a scrollAxis) rect(breadth int) image.Rectangle {
+	if a.vertical {
+		return image.Rect(0, 0, breadth, a.length)
+	}
+	return image.Rect(0, 0, a.length, breadth)
+}
+
+// origin returns the origin of a display of the given length showing the
+// image from position pos
+func (a scrollAxis) origin(pos int, displayLength int) image.Point {
+	if a.reversed {
+		pos = a.length - pos - displayLength
+	}
+	if a.vertical {
+		return image.Point{X: 0, Y: pos}
+	}
+	return image.Point{X: pos, Y: 0}
+}
+
 type rollingLayer struct {
-	queue    layersSet
-	position int
+	queue         layersSet
+	position      int
+	displayWidth  int
+	displayHeight int
+	frameRate     int
+	fraction      float64 // fraction of pixel accumulated by slow layers
+	hold          int     // number of frames to wait before moving again
 }
 
 func (rl *rollingLayer) reset() {
 	rl.queue = rl.queue[:0]
+	rl.fraction = 0
+	rl.hold = 0
 }
 
 func (rl *rollingLayer) enqueue(l *layer) {
 	rl.queue = append(rl.queue, l)
 }
 
+// displayLength returns the size of the display along the scrolling
+// direction of the current layer
+func (rl *rollingLayer) displayLength() int {
+	if rl.queue[0].rolling.vertical() {
+		return rl.displayHeight
+	}
+	return rl.displayWidth
+}
+
 func (rl *rollingLayer) setPos(pos int) {
 	rl.position = pos
-	rl.queue[0].origin.X = pos
+	l := rl.queue[0]
+	l.origin = newScrollAxis(&l.rolling, l.image.Bounds()).origin(pos, rl.displayLength())
+}
+
+// advance moves the layer by the distance covered during the given number
+// of frames. Layers without speed move by one pixel per frame. The layer
+// stops when a line reaches the edge of the display and waits for the
+// pause of the layer.
+func (rl *rollingLayer) advance(frames int) {
+	if rl.hold >= frames {
+		rl.hold -= frames
+		return
+	}
+	frames -= rl.hold
+	rl.hold = 0
+
+	n := frames
+	if speed := rl.queue[0].rolling.speed; speed > 0 {
+		rl.fraction += speed * float64(frames) / float64(rl.frameRate)
+		n = int(rl.fraction)
+		rl.fraction -= float64(n)
+	}
+	for i := 0; i < n; i++ {
+		rl.step()
+		if rl.atLine() {
+			rl.hold = int(rl.queue[0].rolling.pause.Seconds() * float64(rl.frameRate))
+			rl.fraction = 0
+			break
+		}
+	}
 }
 
-func (rl *rollingLayer) advance() {
-	if rl.position+displayWidth >= rl.queue[0].image.Bounds().Max.X {
-		rl.setPos(displayWidth - 1 + rl.queue[0].rolling.entry)
-	} else if rl.position == rl.queue[0].rolling.last && len(rl.queue) > 1 {
+// atLine reports whether a line of the current layer is aligned with the
+// edge of the display
+func (rl *rollingLayer) atLine() bool {
+	r := &rl.queue[0].rolling
+	if r.pause <= 0 || r.cycle <= 0 {
+		return false
+	}
+	lineHeight := r.lineHeight
+	if lineHeight <= 0 {
+		lineHeight = rl.displayLength()
+	}
+	// offset of the display in the body of the image, the entry being
+	// shown once and the body and separator repeated. The lines start at
+	// the beginning of the body.
+	offset := rl.position - (rl.displayLength() - 1) - r.entry
+	if offset < 0 {
+		return false
+	}
+	return offset%r.cycle%lineHeight == 0
+}
+
+func (rl *rollingLayer) step() {
+	l := rl.queue[0]
+	length := newScrollAxis(&l.rolling, l.image.Bounds()).length
+	if rl.position+rl.displayLength() >= length {
+		rl.setPos(rl.displayLength() - 1 + l.rolling.entry)
+	} else if rl.position == l.rolling.last && len(rl.queue) > 1 {
 		log.Debug("Switch rolling layer")
-		rl.setPos(0)
 		rl.queue = rl.queue[1:]
+		rl.setPos(0)
 	} else {
 		rl.setPos(rl.position + 1)
 	}
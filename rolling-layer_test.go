@@ -0,0 +1,222 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/telecom-tower/sdk"
+)
+
+// The rolling layers of these tests are shown on a 4x4 display. Their
+// image is 10 pixels long along the scrolling direction, with an entry of
+// 2 pixels and a separator of 1 pixel. Once prepared, the image is 16
+// pixels long: 3 pixels of prolog, the entry, one body and separator (the
+// cycle of 8 pixels) and 3 pixels to wrap around. The layer goes back to
+// the start of the body (position 5) after position 12.
+const (
+	testDisplayLength = 4
+	testRollingLength = 16
+	testBodyStart     = 5
+)
+
+var directions = []struct {
+	name      string
+	direction int
+}{
+	{"left", rollingLeft},
+	{"right", rollingRight},
+	{"up", rollingUp},
+	{"down", rollingDown},
+}
+
+func newRollingLayer(direction int, r rolling) *rollingLayer {
+	r.mode = sdk.RollingContinue
+	r.direction = direction
+	r.entry = 2
+	r.separator = 1
+	bounds := image.Rect(0, 0, 10, testDisplayLength)
+	if r.vertical() {
+		bounds = image.Rect(0, 0, testDisplayLength, 10)
+	}
+	l := preparedLayer(&layer{
+		image:   image.NewRGBA(bounds),
+		alpha:   0xffff,
+		rolling: r,
+	}, testDisplayLength, testDisplayLength)
+	rl := &rollingLayer{
+		displayWidth:  testDisplayLength,
+		displayHeight: testDisplayLength,
+		frameRate:     100,
+	}
+	rl.enqueue(l)
+	rl.setPos(0)
+	return rl
+}
+
+func TestRollingLayerStep(t *testing.T) {
+	// origin of the display for a given position
+	origins := map[int]func(pos int) image.Point{
+		rollingLeft:  func(pos int) image.Point { return image.Pt(pos, 0) },
+		rollingRight: func(pos int) image.Point { return image.Pt(testRollingLength-testDisplayLength-pos, 0) },
+		rollingUp:    func(pos int) image.Point { return image.Pt(0, pos) },
+		rollingDown:  func(pos int) image.Point { return image.Pt(0, testRollingLength-testDisplayLength-pos) },
+	}
+	for _, d := range directions {
+		t.Run(d.name, func(t *testing.T) {
+			rl := newRollingLayer(d.direction, rolling{})
+			for i := 1; i <= 20; i++ {
+				rl.step()
+				want := i
+				if i > testRollingLength-testDisplayLength {
+					want = testBodyStart + i - (testRollingLength - testDisplayLength + 1)
+				}
+				if rl.position != want {
+					t.Fatalf("step %d: position = %d, want %d", i, rl.position, want)
+				}
+				if got, want := rl.queue[0].origin, origins[d.direction](want); got != want {
+					t.Fatalf("step %d: origin = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRollingLayerStepNextLayer(t *testing.T) {
+	for _, d := range directions {
+		t.Run(d.name, func(t *testing.T) {
+			rl := newRollingLayer(d.direction, rolling{})
+			next := newRollingLayer(d.direction, rolling{}).queue[0]
+			rl.enqueue(next)
+			last := rl.queue[0].rolling.last
+			rl.setPos(last - 1)
+			rl.step()
+			if rl.queue[0] == next || rl.position != last {
+				t.Fatalf("switched to the next layer before the last position")
+			}
+			rl.step()
+			if rl.queue[0] != next || rl.position != 0 {
+				t.Errorf("after the last position: next layer = %v, position = %d",
+					rl.queue[0] == next, rl.position)
+			}
+		})
+	}
+}
+
+func TestRollingLayerAtLine(t *testing.T) {
+	tests := []struct {
+		lineHeight int
+		pause      time.Duration
+		aligned    []int // positions where a line is aligned
+	}{
+		{lineHeight: 0, pause: 0, aligned: nil},
+		{lineHeight: 0, pause: time.Second, aligned: []int{5, 9, 13}},
+		{lineHeight: 2, pause: time.Second, aligned: []int{5, 7, 9, 11, 13, 15}},
+		{lineHeight: 3, pause: time.Second, aligned: []int{5, 8, 11, 13, 16}},
+	}
+	for _, d := range directions {
+		for _, tt := range tests {
+			name := fmt.Sprintf("%s/lineHeight=%d/pause=%v", d.name, tt.lineHeight, tt.pause)
+			t.Run(name, func(t *testing.T) {
+				rl := newRollingLayer(d.direction, rolling{lineHeight: tt.lineHeight, pause: tt.pause})
+				aligned := map[int]bool{}
+				for _, pos := range tt.aligned {
+					aligned[pos] = true
+				}
+				for pos := 0; pos <= 16; pos++ {
+					rl.setPos(pos)
+					if got := rl.atLine(); got != aligned[pos] {
+						t.Errorf("atLine at position %d = %v, want %v", pos, got, aligned[pos])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRollingLayerAdvance(t *testing.T) {
+	tests := []struct {
+		name   string
+		speed  float64
+		pause  time.Duration
+		start  int
+		frames []int // frames of each call to advance
+		want   []int // position after each call
+	}{
+		{
+			name:   "one pixel per frame",
+			frames: []int{1, 1, 3},
+			want:   []int{1, 2, 5},
+		},
+		{
+			name:   "slow speed",
+			speed:  25,
+			frames: []int{1, 1, 1, 1, 2, 4},
+			want:   []int{0, 0, 0, 1, 1, 2},
+		},
+		{
+			name:   "fast speed",
+			speed:  150,
+			frames: []int{1, 1, 1, 2},
+			want:   []int{1, 3, 4, 7},
+		},
+		{
+			name:   "fractional speed across calls",
+			speed:  50,
+			frames: []int{3, 1, 3},
+			want:   []int{1, 2, 3},
+		},
+		{
+			name:   "pause at each line",
+			pause:  50 * time.Millisecond,
+			start:  3,
+			frames: []int{1, 1, 3, 2, 1, 3, 4, 2},
+			want:   []int{4, 5, 5, 5, 6, 9, 9, 10},
+		},
+		{
+			name:   "pause stops a fast move at the line",
+			speed:  500,
+			pause:  50 * time.Millisecond,
+			start:  3,
+			frames: []int{1, 5, 1},
+			want:   []int{5, 5, 9},
+		},
+		{
+			name:   "pause consumed by a long call",
+			pause:  50 * time.Millisecond,
+			start:  4,
+			frames: []int{1, 7},
+			want:   []int{5, 7},
+		},
+	}
+	for _, d := range directions {
+		for _, tt := range tests {
+			t.Run(d.name+"/"+tt.name, func(t *testing.T) {
+				rl := newRollingLayer(d.direction, rolling{speed: tt.speed, pause: tt.pause})
+				rl.setPos(tt.start)
+				for i, frames := range tt.frames {
+					rl.advance(frames)
+					if rl.position != tt.want[i] {
+						t.Fatalf("call %d: advance(%d) position = %d, want %d",
+							i, frames, rl.position, tt.want[i])
+					}
+				}
+			})
+		}
+	}
+}
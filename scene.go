@@ -0,0 +1,312 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+	"github.com/telecom-tower/sdk"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Scene is a snapshot of all the layers of a renderer. It is serialized
+// as JSON, with the images of the layers encoded as PNG.
+type Scene struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Brightness is the global brightness. The brightness is unchanged
+	// if it is missing or 0, a scene never blacks out the display.
+	Brightness *int         `json:"brightness,omitempty"`
+	Layers     []SceneLayer `json:"layers"`
+}
+
+// SceneLayer is the state of one layer in a scene. The PNG image has no
+// offset, Min is the position of its top left corner in the layer.
+type SceneLayer struct {
+	Active  bool         `json:"active"`
+	Origin  image.Point  `json:"origin"`
+	Alpha   int          `json:"alpha"`
+	Min     image.Point  `json:"min"`
+	Image   []byte       `json:"image,omitempty"`
+	Rolling SceneRolling `json:"rolling"`
+}
+
+// SceneRolling holds the rolling parameters of a layer in a scene
+type SceneRolling struct {
+	Mode       int     `json:"mode"`
+	Entry      int     `json:"entry"`
+	Separator  int     `json:"separator"`
+	Direction  int     `json:"direction"`
+	Speed      float64 `json:"speed"`
+	PauseMs    int64   `json:"pause_ms"`
+	LineHeight int     `json:"line_height"`
+}
+
+// LoadScene reads a scene from a file
+func LoadScene(filename string) (*Scene, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	scene := &Scene{}
+	if err := json.Unmarshal(data, scene); err != nil {
+		return nil, errors.WithMessage(err, "invalid scene "+filename)
+	}
+	return scene, nil
+}
+
+// Save writes the scene to a file. The file is replaced atomically, so a
+// crash while saving never leaves a truncated scene.
+func (scene *Scene) Save(filename string) error {
+	data, err := json.Marshal(scene)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".scene")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()           // nolint: errcheck
+		os.Remove(tmp.Name()) // nolint: errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name()) // nolint: errcheck
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Snapshot returns the current scene of the renderer
+func (tower *TowerRenderer) Snapshot() (*Scene, error) {
+	layers, active := tower.committedLayers()
+
+	brightness := int(tower.Brightness())
+	scene := &Scene{
+		Width:      tower.config.Width,
+		Height:     tower.config.Height,
+		Brightness: &brightness,
+		Layers:     make([]SceneLayer, len(layers)),
+	}
+	for i, l := range layers {
+		sl := SceneLayer{
+			Active: active[i],
+			Origin: l.origin,
+			Alpha:  l.alpha,
+			Min:    l.image.Bounds().Min,
+			Rolling: SceneRolling{
+				Mode:       l.rolling.mode,
+				Entry:      l.rolling.entry,
+				Separator:  l.rolling.separator,
+				Direction:  l.rolling.direction,
+				Speed:      l.rolling.speed,
+				PauseMs:    int64(l.rolling.pause / time.Millisecond),
+				LineHeight: l.rolling.lineHeight,
+			},
+		}
+		if !l.image.Bounds().Empty() {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, l.image); err != nil {
+				return nil, errors.WithMessage(err, "encoding layer")
+			}
+			sl.Image = buf.Bytes()
+		}
+		scene.Layers[i] = sl
+	}
+	return scene, nil
+}
+
+// sceneLayerError adds the index of the offending layer to the status of
+// err
+func sceneLayerError(index int, err error) error {
+	st := status.Convert(err)
+	return status.Errorf(st.Code(), "layer %d: %s", index, st.Message())
+}
+
+// newLayer builds a layer from its description in a scene shown on a
+// display of the given configuration
+func (sl *SceneLayer) newLayer(config Config) (*layer, error) {
+	if err := checkRollingMode(sl.Rolling.Mode); err != nil {
+		return nil, err
+	}
+	if err := checkRollingDirection(sl.Rolling.Direction); err != nil {
+		return nil, err
+	}
+	if sl.Alpha < 0 || sl.Alpha > 0xffff {
+		return nil, outOfRange("alpha %d out of range [0, 65535]", sl.Alpha)
+	}
+	if sl.Rolling.Speed < 0 || sl.Rolling.PauseMs < 0 || sl.Rolling.LineHeight < 0 ||
+		sl.Rolling.Entry < 0 || sl.Rolling.Separator < 0 {
+		return nil, invalidArgument("negative rolling parameter")
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 0, 0))
+	if len(sl.Image) > 0 {
+		// check the size before decoding, a small PNG can hold a huge image
+		cfg, err := png.DecodeConfig(bytes.NewReader(sl.Image))
+		if err != nil {
+			return nil, invalidArgument("invalid image: %v", err)
+		}
+		if max := config.maxCanvas(); cfg.Width > max || cfg.Height > max || cfg.Width*cfg.Height > max {
+			return nil, outOfRange("image has %dx%d pixels, more than %d",
+				cfg.Width, cfg.Height, max)
+		}
+		src, err := png.Decode(bytes.NewReader(sl.Image))
+		if err != nil {
+			return nil, invalidArgument("invalid image: %v", err)
+		}
+		b := src.Bounds()
+		img = image.NewRGBA(image.Rectangle{Min: sl.Min, Max: sl.Min.Add(b.Size())})
+		draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+	}
+	l := &layer{
+		image:  img,
+		origin: sl.Origin,
+		alpha:  sl.Alpha,
+		rolling: rolling{
+			mode:       sl.Rolling.Mode,
+			entry:      sl.Rolling.Entry,
+			separator:  sl.Rolling.Separator,
+			direction:  sl.Rolling.Direction,
+			speed:      sl.Rolling.Speed,
+			pause:      time.Duration(sl.Rolling.PauseMs) * time.Millisecond,
+			lineHeight: sl.Rolling.LineHeight,
+		},
+	}
+	// the queue of the rolling layer is lost, the layer restarts rolling
+	// from its entry
+	if l.rolling.mode == sdk.RollingNext || l.rolling.mode == sdk.RollingContinue {
+		l.rolling.mode = sdk.RollingStart
+	}
+	return l, nil
+}
+
+// Restore replaces all the layers of the renderer by the ones of the scene
+// and displays them. Layers missing from the scene are cleared. Nothing is
+// changed if the scene is invalid.
+func (tower *TowerRenderer) Restore(scene *Scene) error {
+	if len(scene.Layers) > tower.config.Layers {
+		return outOfRange("scene has %d layers, the display only %d",
+			len(scene.Layers), tower.config.Layers)
+	}
+	if b := scene.Brightness; b != nil && (*b < 0 || *b > 0xff) {
+		return outOfRange("brightness %d out of range [0, 255]", *b)
+	}
+	if scene.Width != tower.config.Width || scene.Height != tower.config.Height {
+		log.Warnf("Restoring a %dx%d scene on a %dx%d display",
+			scene.Width, scene.Height, tower.config.Width, tower.config.Height)
+	}
+	layers := make(layersSet, tower.config.Layers)
+	active := make([]bool, tower.config.Layers)
+	for i := range layers {
+		if i >= len(scene.Layers) {
+			layers[i] = &layer{}
+			resetLayer(layers[i])
+			layers[i].dirty = false
+			continue
+		}
+		l, err := scene.Layers[i].newLayer(tower.config)
+		if err != nil {
+			return sceneLayerError(i, err)
+		}
+		layers[i] = l
+		active[i] = scene.Layers[i].Active
+	}
+
+	tower.mu.Lock()
+	defer tower.mu.Unlock()
+	tower.layers = layers
+	tower.activeLayers = active
+	if b := scene.Brightness; b != nil && *b > 0 {
+		tower.SetBrightness(uint8(*b))
+	}
+	tower.update(context.Background())
+	return nil
+}
+
+// restoreStartupScene loads the scene of the configuration, if any. A
+// missing file is not an error, the display then starts empty.
+func (tower *TowerRenderer) restoreStartupScene() error {
+	if tower.config.Scene == "" {
+		return nil
+	}
+	scene, err := LoadScene(tower.config.Scene)
+	if os.IsNotExist(err) {
+		log.Infof("No scene to restore in %v", tower.config.Scene)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("Restoring scene from %v", tower.config.Scene)
+	return errors.WithMessage(tower.Restore(scene), "failed to restore scene")
+}
+
+// GetScene returns the current scene, serialized as JSON. With Persist,
+// the scene is also saved to the scene file of the configuration.
+func (tower *TowerRenderer) GetScene(ctx context.Context, req *api.GetSceneRequest) (*api.Scene, error) {
+	log.Debugf("Get scene (persist: %v)", req.Persist)
+	if req.Persist {
+		if err := checkGlobal(ctx, "saving the scene"); err != nil {
+			return nil, err
+		}
+	}
+	scene, err := tower.Snapshot()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	data, err := json.Marshal(scene)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	if req.Persist {
+		if tower.config.Scene == "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "no scene file configured")
+		}
+		if err := scene.Save(tower.config.Scene); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+	}
+	return &api.Scene{Data: data}, nil
+}
+
+// SetScene replaces the current scene by the one given as JSON
+func (tower *TowerRenderer) SetScene(ctx context.Context, req *api.Scene) (*api.SetSceneResponse, error) {
+	log.Debug("Set scene")
+	if err := checkGlobal(ctx, "setting the scene"); err != nil {
+		return nil, err
+	}
+	scene := &Scene{}
+	if err := json.Unmarshal(req.Data, scene); err != nil {
+		return nil, invalidArgument("invalid scene: %v", err)
+	}
+	if err := tower.Restore(scene); err != nil {
+		return nil, err
+	}
+	return &api.SetSceneResponse{}, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/telecom-tower/sdk"
+	pb "github.com/telecom-tower/towerapi/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSceneRoundTrip(t *testing.T) {
+	tower, stop := newTestRenderer()
+	defer stop()
+	stream := &fakeDrawStream{requests: []*pb.DrawRequest{
+		rectangle(1, 2, 6, 0x40),
+		rectangle(1, 6, 9, 0x80),
+		rectangle(2, 0, 16, 0xc0),
+	}}
+	if err := tower.Draw(stream); err != nil {
+		t.Fatal(err)
+	}
+	tower.mu.Lock()
+	tower.layers[1].origin = image.Pt(3, 1)
+	tower.layers[1].alpha = 0x8000
+	tower.layers[2].rolling = rolling{
+		mode:       sdk.RollingContinue,
+		entry:      16,
+		separator:  4,
+		direction:  rollingUp,
+		speed:      12.5,
+		pause:      200 * time.Millisecond,
+		lineHeight: 8,
+	}
+	tower.activeLayers[3] = false
+	tower.mu.Unlock()
+	tower.SetBrightness(0x80)
+
+	scene, err := tower.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "scene.json")
+	if err := scene.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadScene(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, scene) {
+		t.Fatalf("loaded scene differs from the saved one:\n%+v\n%+v", loaded, scene)
+	}
+
+	restored, stopRestored := newTestRenderer()
+	defer stopRestored()
+	if err := restored.Restore(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.Brightness(); got != 0x80 {
+		t.Errorf("brightness = %#x, want 0x80", got)
+	}
+	want, wantActive := tower.committedLayers()
+	got, gotActive := restored.committedLayers()
+	if !reflect.DeepEqual(gotActive, wantActive) {
+		t.Errorf("active layers = %v, want %v", gotActive, wantActive)
+	}
+	for i := range want {
+		if got[i].image.Bounds() != want[i].image.Bounds() ||
+			!bytes.Equal(got[i].image.Pix, want[i].image.Pix) {
+			t.Errorf("layer %d: image %v differs from %v", i, got[i].image.Bounds(), want[i].image.Bounds())
+		}
+		if got[i].origin != want[i].origin || got[i].alpha != want[i].alpha {
+			t.Errorf("layer %d: origin %v, alpha %#x, want %v, %#x",
+				i, got[i].origin, got[i].alpha, want[i].origin, want[i].alpha)
+		}
+		wantRolling := want[i].rolling
+		if wantRolling.mode == sdk.RollingContinue {
+			// restored layers restart rolling from their entry
+			wantRolling.mode = sdk.RollingStart
+		}
+		// the wrap is computed when the layer is displayed
+		gotRolling := got[i].rolling
+		gotRolling.wrap, wantRolling.wrap = nil, nil
+		if gotRolling != wantRolling {
+			t.Errorf("layer %d: rolling %+v, want %+v", i, gotRolling, wantRolling)
+		}
+	}
+}
+
+func TestRestoreImageSize(t *testing.T) {
+	// the display of newTestRenderer has 16x8 pixels
+	max := maxCanvasDisplays * 16 * 8
+	tests := []struct {
+		name          string
+		width, height int
+		code          codes.Code
+	}{
+		{name: "largest image", width: max / 8, height: 8, code: codes.OK},
+		{name: "too wide", width: max + 1, height: 1, code: codes.OutOfRange},
+		{name: "too high", width: 1, height: max + 1, code: codes.OutOfRange},
+		{name: "too many pixels", width: max / 8, height: 9, code: codes.OutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tower, stop := newTestRenderer()
+			defer stop()
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, tt.width, tt.height))); err != nil {
+				t.Fatal(err)
+			}
+			scene := &Scene{Width: 16, Height: 8, Layers: []SceneLayer{
+				{Active: true, Alpha: 0xffff, Image: buf.Bytes()},
+			}}
+			err := tower.Restore(scene)
+			if got := status.Code(err); got != tt.code {
+				t.Fatalf("Restore(%dx%d) = %v, want %v", tt.width, tt.height, err, tt.code)
+			}
+			layers, _ := tower.committedLayers()
+			size := layers[0].image.Bounds().Size()
+			if tt.code == codes.OK && size != image.Pt(tt.width, tt.height) {
+				t.Errorf("restored image has %v pixels", size)
+			}
+			if tt.code != codes.OK && size != image.Pt(0, 0) {
+				t.Errorf("rejected scene changed the layer to %v pixels", size)
+			}
+		})
+	}
+}
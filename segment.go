@@ -0,0 +1,134 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+)
+
+// Segment routes a region of the display to a range of LEDs on a channel
+// of a WsEngine. Several segments can share the same channel as long as
+// their LEDs do not overlap.
+type Segment struct {
+	// Bounds is the region of the display covered by the segment
+	Bounds image.Rectangle
+	// Mapper maps the pixels of the region (relative to Bounds.Min) to the
+	// LEDs of the segment. The default is the wiring of the telecom tower.
+	Mapper PixelMapper
+	// Engine drives the segment. The default is the engine of the renderer.
+	Engine WsEngine
+	// Channel is the channel of the engine
+	Channel int
+	// Offset is the index of the first LED of the segment on the channel
+	Offset int
+}
+
+// channelOutput is the LED buffer of one channel of an engine
+type channelOutput struct {
+	engine  WsEngine
+	channel int
+	length  int
+	leds    []uint32
+}
+
+// boundSegment is a segment attached to its output buffer
+type boundSegment struct {
+	Segment
+	out *channelOutput
+}
+
+// bindSegments resolves the defaults of the segments and allocates the
+// output buffers. It returns the segments, the outputs and the list of
+// distinct engines.
+func bindSegments(ws WsEngine, segments []Segment) ([]boundSegment, []*channelOutput, []WsEngine) {
+	var outputs []*channelOutput
+	var engines []WsEngine
+	bound := make([]boundSegment, len(segments))
+	for i, seg := range segments {
+		if seg.Engine == nil {
+			seg.Engine = ws
+		}
+		if seg.Mapper == nil {
+			seg.Mapper = &MatrixMapper{
+				Width:      seg.Bounds.Dx(),
+				Height:     seg.Bounds.Dy(),
+				Serpentine: true,
+			}
+		}
+		var out *channelOutput
+		for _, o := range outputs {
+			if o.engine == seg.Engine && o.channel == seg.Channel {
+				out = o
+				break
+			}
+		}
+		if out == nil {
+			out = &channelOutput{engine: seg.Engine, channel: seg.Channel}
+			outputs = append(outputs, out)
+		}
+		if n := seg.Offset + seg.Mapper.Len(); n > out.length {
+			out.length = n
+		}
+
+		known := false
+		for _, e := range engines {
+			if e == seg.Engine {
+				known = true
+				break
+			}
+		}
+		if !known {
+			engines = append(engines, seg.Engine)
+		}
+		bound[i] = boundSegment{Segment: seg, out: out}
+	}
+	return bound, outputs, engines
+}
+
+// ledPositions returns, for each channel of the engine ws, the position on
+// the display of the LEDs driven by ws. Unmapped LEDs are at (-1, -1).
+// Segments without engine are attributed to ws.
+func (c Config) ledPositions(ws WsEngine) map[int][]image.Point {
+	c = c.normalized()
+	segments, outputs, _ := bindSegments(ws, c.Segments)
+	positions := make(map[int][]image.Point)
+	for _, out := range outputs {
+		if out.engine != ws {
+			continue
+		}
+		leds := make([]image.Point, out.length)
+		for i := range leds {
+			leds[i] = image.Point{X: -1, Y: -1}
+		}
+		positions[out.channel] = leds
+	}
+	for _, seg := range segments {
+		if seg.Engine != ws {
+			continue
+		}
+		leds := positions[seg.Channel]
+		bounds := seg.Bounds.Intersect(image.Rect(0, 0, c.Width, c.Height))
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				index := seg.Mapper.Index(x-seg.Bounds.Min.X, y-seg.Bounds.Min.Y)
+				if index < 0 || index >= seg.Mapper.Len() {
+					continue
+				}
+				leds[seg.Offset+index] = image.Point{X: x, Y: y}
+			}
+		}
+	}
+	return positions
+}
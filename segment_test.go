@@ -0,0 +1,107 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"testing"
+)
+
+// nopEngine is a WsEngine doing nothing. Its name tells the engines apart.
+type nopEngine struct{ name string }
+
+func (e *nopEngine) Init() error                     { return nil }
+func (e *nopEngine) Fini()                           {}
+func (e *nopEngine) Render() error                   { return nil }
+func (e *nopEngine) Wait() error                     { return nil }
+func (e *nopEngine) SetLedsSync(int, []uint32) error { return nil }
+
+func TestBindSegments(t *testing.T) {
+	main, other := &nopEngine{"main"}, &nopEngine{"other"}
+	segments := []Segment{
+		// two panels of 4x2 LEDs chained on channel 0 of the main engine
+		{Bounds: image.Rect(0, 0, 4, 2)},
+		{Bounds: image.Rect(4, 0, 8, 2), Offset: 8},
+		// a panel on channel 1, starting after 2 unused LEDs
+		{Bounds: image.Rect(0, 2, 8, 3), Channel: 1, Offset: 2},
+		// channel 0 of another engine is a different output
+		{Bounds: image.Rect(0, 3, 2, 4), Engine: other},
+		// a segment before the end of the channel does not shrink it
+		{Bounds: image.Rect(8, 0, 9, 2), Offset: 4},
+	}
+	bound, outputs, engines := bindSegments(main, segments)
+
+	tests := []struct {
+		engine  WsEngine
+		channel int
+		length  int
+	}{
+		{main, 0, 16},
+		{main, 1, 10},
+		{other, 0, 2},
+	}
+	if len(outputs) != len(tests) {
+		t.Fatalf("%d outputs, want %d", len(outputs), len(tests))
+	}
+	for i, tt := range tests {
+		out := outputs[i]
+		if out.engine != tt.engine || out.channel != tt.channel || out.length != tt.length {
+			t.Errorf("output %d: engine %v, channel %d, length %d, want %v, %d, %d",
+				i, out.engine, out.channel, out.length, tt.engine, tt.channel, tt.length)
+		}
+	}
+	for i, out := range []int{0, 0, 1, 2, 0} {
+		if bound[i].out != outputs[out] {
+			t.Errorf("segment %d bound to the wrong output", i)
+		}
+	}
+	if len(engines) != 2 || engines[0] != main || engines[1] != other {
+		t.Errorf("engines %v, want [main other]", engines)
+	}
+	if m, ok := bound[0].Mapper.(*MatrixMapper); !ok || *m != (MatrixMapper{Width: 4, Height: 2, Serpentine: true}) {
+		t.Errorf("default mapper %+v", bound[0].Mapper)
+	}
+}
+
+func TestLedPositions(t *testing.T) {
+	main := &nopEngine{"main"}
+	config := Config{
+		Width:  4,
+		Height: 2,
+		Segments: []Segment{
+			{Bounds: image.Rect(0, 0, 2, 2), Offset: 4},
+			{Bounds: image.Rect(2, 0, 4, 2)},
+			// other engines are ignored
+			{Bounds: image.Rect(0, 0, 4, 2), Offset: 8, Engine: &nopEngine{"other"}},
+		},
+	}
+	positions := config.ledPositions(main)
+	if len(positions) != 1 {
+		t.Fatalf("%d channels, want 1", len(positions))
+	}
+	want := []image.Point{
+		{2, 0}, {2, 1}, {3, 1}, {3, 0},
+		{0, 0}, {0, 1}, {1, 1}, {1, 0},
+	}
+	leds := positions[0]
+	if len(leds) != len(want) {
+		t.Fatalf("%d LEDs, want %d", len(leds), len(want))
+	}
+	for i, p := range want {
+		if leds[i] != p {
+			t.Errorf("LED %d at %v, want %v", i, leds[i], p)
+		}
+	}
+}
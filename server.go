@@ -0,0 +1,142 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"image/draw"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const defaultShutdownTimeout = 5 * time.Second
+
+// Server serves a TowerRenderer over gRPC and manages the life cycle of
+// its engines: they are initialized when the server starts, and blanked
+// and finalized when it stops.
+type Server struct {
+	// Goodbye is displayed when the server stops. The display is blanked
+	// if it is nil.
+	Goodbye image.Image
+	// ShutdownTimeout is the time given to the running streams to finish
+	// when the server stops. They are canceled afterwards (default 5s).
+	ShutdownTimeout time.Duration
+
+	tower *TowerRenderer
+	opts  []grpc.ServerOption
+}
+
+// NewServer returns a new server for the renderer
+func NewServer(tower *TowerRenderer, opts ...grpc.ServerOption) *Server {
+	return &Server{
+		ShutdownTimeout: defaultShutdownTimeout,
+		tower:           tower,
+		opts:            opts,
+	}
+}
+
+// Run initializes the engines and handles the requests until ctx is
+// done or the listener fails. It then waits for the running Draw streams,
+// stops the renderer, shows the goodbye frame and finalizes the engines.
+// A renderer is served only once, Run fails if it already was.
+func (server *Server) Run(ctx context.Context, listener net.Listener) error {
+	tower := server.tower
+	if err := tower.setStarted(); err != nil {
+		return err
+	}
+	for i, engine := range tower.engines {
+		if err := engine.Init(); err != nil {
+			for _, e := range tower.engines[:i] {
+				e.Fini()
+			}
+			tower.health.set(EngineFailing, err)
+			return errors.WithMessage(err, "failed to initialize engine")
+		}
+	}
+	tower.health.set(EngineHealthy, nil)
+
+	grpcServer := tower.start(server.opts...)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- grpcServer.Serve(listener)
+	}()
+	log.Infof("Telecom Tower Server running at %v\n", listener.Addr().String())
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Info("Shutting down Telecom Tower Server")
+		server.shutdown(grpcServer)
+		<-errc
+	case err = <-errc:
+		err = errors.WithMessage(err, "failed to serve")
+		close(tower.closing)
+		grpcServer.Stop()
+	}
+
+	tower.stop()
+	server.goodbye()
+	for _, engine := range tower.engines {
+		engine.Fini()
+	}
+	tower.health.set(EngineUninitialized, nil)
+	return err
+}
+
+// shutdown stops accepting requests and waits for the running ones
+func (server *Server) shutdown(grpcServer *grpc.Server) {
+	// the probes see the server going down before the streams end
+	server.tower.healthServer.Shutdown()
+	// the frames streams never end by themselves
+	close(server.tower.closing)
+	done := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(server.ShutdownTimeout):
+		log.Warn("Canceling the remaining streams")
+		grpcServer.Stop()
+		<-done
+	}
+}
+
+// goodbye shows the goodbye frame, or blanks the display. The loop must
+// be stopped.
+func (server *Server) goodbye() {
+	var ls layersSet
+	if server.Goodbye != nil {
+		bounds := server.Goodbye.Bounds()
+		img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(img, img.Bounds(), server.Goodbye, bounds.Min, draw.Src)
+		ls = layersSet{{image: img, alpha: 0xffff}}
+	}
+	if err := server.tower.renderLed(ls); err != nil {
+		log.Errorf("Failed to show goodbye frame: %v", err)
+		return
+	}
+	for _, engine := range server.tower.engines {
+		if err := engine.Wait(); err != nil {
+			log.Errorf("Failed to show goodbye frame: %v", err)
+		}
+	}
+}
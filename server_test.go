@@ -0,0 +1,170 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// lifecycleEngine records its initialization, its finalization and the
+// first LEDs which are not black
+type lifecycleEngine struct {
+	mu     sync.Mutex
+	events []string
+	lit    bool
+}
+
+func (e *lifecycleEngine) Init() error   { e.record("init"); return nil }
+func (e *lifecycleEngine) Fini()         { e.record("fini") }
+func (e *lifecycleEngine) Render() error { return nil }
+func (e *lifecycleEngine) Wait() error   { return nil }
+
+func (e *lifecycleEngine) SetLedsSync(channel int, leds []uint32) error {
+	for _, c := range leds {
+		if c != 0 {
+			e.mu.Lock()
+			lit := e.lit
+			e.lit = true
+			e.mu.Unlock()
+			if !lit {
+				e.record("lit")
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func (e *lifecycleEngine) record(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *lifecycleEngine) recorded() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.events...)
+}
+
+func TestServerLifecycle(t *testing.T) {
+	engine := &lifecycleEngine{}
+	tower := NewRenderer(engine, Config{Width: 4, Height: 1, Layers: 1})
+	// the second GetState is held until release is closed
+	held := make(chan struct{})
+	release := make(chan struct{})
+	var calls int32
+	server := NewServer(tower, grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if info.FullMethod == api.TowerControl_GetState_FullMethodName && atomic.AddInt32(&calls, 1) == 2 {
+				close(held)
+				<-release
+			}
+			return handler(ctx, req)
+		}))
+	goodbye := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	draw.Draw(goodbye, goodbye.Bounds(), image.NewUniform(color.RGBA{R: 0xff, A: 0xff}), image.Point{}, draw.Src)
+	server.Goodbye = goodbye
+
+	listener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run(ctx, listener)
+	}()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // nolint: errcheck
+
+	// the engines are initialized before the requests are served
+	client := api.NewTowerControlClient(conn)
+	if _, err := client.GetState(context.Background(), &api.GetStateRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := engine.recorded(), []string{"init"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events while serving = %v, want %v", got, want)
+	}
+
+	// the server waits for the running requests before stopping
+	running := make(chan error, 1)
+	go func() {
+		_, err := client.GetState(context.Background(), &api.GetStateRequest{})
+		running <- err
+	}()
+	select {
+	case <-held:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the running request")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned %v with a running request", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if got, want := engine.recorded(), []string{"init"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events while stopping = %v, want %v", got, want)
+	}
+	close(release)
+	if err := <-running; err != nil {
+		t.Fatalf("running request failed: %v", err)
+	}
+
+	// then it shows the goodbye frame and finalizes the engines
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the end of Run")
+	}
+	if got, want := engine.recorded(), []string{"init", "lit", "fini"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events after Run = %v, want %v", got, want)
+	}
+
+	// a renderer is served only once
+	if err := server.Run(context.Background(), bufconn.Listen(1<<20)); err == nil {
+		t.Error("second Run succeeded")
+	}
+	if err := tower.Serve(bufconn.Listen(1 << 20)); err == nil {
+		t.Error("Serve after Run succeeded")
+	}
+	if got, want := engine.recorded(), []string{"init", "lit", "fini"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events after the second Run = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"image/draw"
+
+	"golang.org/x/net/context"
+)
+
+// drawSession holds the changes made by a Draw stream. The stream works on
+// a private copy of the layers which is committed atomically to the
+// renderer at the end of the stream.
+type drawSession struct {
+	config       Config
+	layers       layersSet
+	activeLayers []bool
+	permissions  *Permissions // rights of the client, nil allows everything
+}
+
+// newSession returns a session starting from the current state of the
+// renderer, with the rights of the client of ctx
+func (tower *TowerRenderer) newSession(ctx context.Context) *drawSession {
+	tower.mu.Lock()
+	defer tower.mu.Unlock()
+	session := &drawSession{
+		config:       tower.config,
+		layers:       make(layersSet, len(tower.layers)),
+		activeLayers: make([]bool, len(tower.activeLayers)),
+		permissions:  permissionsFrom(ctx),
+	}
+	for i, l := range tower.layers {
+		c := *l
+		c.dirty = false
+		session.layers[i] = &c
+	}
+	copy(session.activeLayers, tower.activeLayers)
+	return session
+}
+
+// layer returns a writable copy of the layer i. The image is copied the
+// first time the layer is modified in the session, the original being
+// still in use by the renderer.
+func (session *drawSession) layer(i uint32) *layer {
+	l := session.layers[i]
+	if !l.dirty {
+		img := image.NewRGBA(l.image.Bounds())
+		draw.Draw(img, img.Bounds(), l.image, img.Bounds().Min, draw.Src)
+		l.image = img
+		l.dirty = true
+	}
+	return l
+}
+
+// commit applies the layers modified by the session to the renderer and
+// sends the new set of layers to the display.
+func (tower *TowerRenderer) commit(ctx context.Context, session *drawSession) {
+	ctx, span := tracer.Start(ctx, "commit")
+	defer span.End()
+	tower.mu.Lock()
+	defer tower.mu.Unlock()
+	for i, l := range session.layers {
+		if l.dirty {
+			l.dirty = false
+			tower.layers[i] = l
+			tower.activeLayers[i] = session.activeLayers[i]
+		}
+	}
+	tower.update(ctx)
+}
+
+// committedLayers returns the layers of the renderer and whether they are
+// active. The layers are shared with the renderer. A commit replaces a
+// layer instead of modifying it, so its image, origin, alpha and rolling
+// parameters may be read without the lock. Its id and its rolling wrap
+// are written by getLayersSet, under the lock, and must not be read.
+func (tower *TowerRenderer) committedLayers() (layersSet, []bool) {
+	tower.mu.Lock()
+	defer tower.mu.Unlock()
+	layers := make(layersSet, len(tower.layers))
+	copy(layers, tower.layers)
+	active := make([]bool, len(tower.activeLayers))
+	copy(active, tower.activeLayers)
+	return layers, active
+}
@@ -0,0 +1,228 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+	"io"
+	"sync"
+	"testing"
+
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+	pb "github.com/telecom-tower/towerapi/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// fakeDrawStream replays requests to Draw, then returns err (io.EOF if
+// nil). Its context is ctx, or the background context if nil.
+type fakeDrawStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	requests []*pb.DrawRequest
+	err      error
+	closed   bool
+}
+
+func (s *fakeDrawStream) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func (s *fakeDrawStream) Recv() (*pb.DrawRequest, error) {
+	if len(s.requests) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *fakeDrawStream) SendAndClose(*pb.DrawResponse) error {
+	s.closed = true
+	return nil
+}
+
+// newTestRenderer returns a renderer without engine whose layers sets are
+// consumed by a goroutine instead of the render loop. The returned
+// function stops it and returns the number of sets received.
+func newTestRenderer() (*TowerRenderer, func() int) {
+	tower := NewRenderer(nil, Config{Width: 16, Height: 8, Layers: 4})
+	lsc := make(chan layersUpdate)
+	tower.lsc = lsc
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range lsc {
+			n++
+		}
+		done <- n
+	}()
+	return tower, func() int {
+		tower.mu.Lock()
+		tower.lsc = nil
+		tower.mu.Unlock()
+		close(lsc)
+		return <-done
+	}
+}
+
+// rectangle returns a request filling columns [x0, x1) of a layer with a
+// gray level
+func rectangle(layer uint32, x0, x1 int32, gray uint32) *pb.DrawRequest {
+	return &pb.DrawRequest{Type: &pb.DrawRequest_DrawRectangle{
+		DrawRectangle: &pb.DrawRectangle{
+			Layer: layer,
+			Min:   &pb.Point{X: x0, Y: 0},
+			Max:   &pb.Point{X: x1, Y: 8},
+			Color: &pb.Color{Red: gray, Green: gray, Blue: gray, Alpha: 0xff},
+		},
+	}}
+}
+
+// layerColors returns the distinct gray levels of a committed layer
+func layerColors(tower *TowerRenderer, layer int) map[uint8]bool {
+	layers, _ := tower.committedLayers()
+	img := layers[layer].image
+	colors := make(map[uint8]bool)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			colors[img.RGBAAt(x, y).R] = true
+		}
+	}
+	return colors
+}
+
+func TestConcurrentDrawStreams(t *testing.T) {
+	tower, stop := newTestRenderer()
+	// streams [0, shared) draw on layer 0, the other ones on a layer of
+	// their own
+	const shared = 4
+	const streams = shared + 3
+	const rounds = 20
+
+	var wg sync.WaitGroup
+	readers := make(chan struct{})
+	go func() {
+		defer close(readers)
+		for i := 0; i < rounds; i++ {
+			if _, err := tower.GetState(context.Background(), &api.GetStateRequest{Pixels: true}); err != nil {
+				t.Error(err)
+			}
+			if _, err := tower.Snapshot(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for s := 0; s < streams; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			layer := uint32(0)
+			if s >= shared {
+				layer = uint32(s - shared + 1)
+			}
+			for i := 0; i < rounds; i++ {
+				gray := uint32(s*rounds + i)
+				stream := &fakeDrawStream{requests: []*pb.DrawRequest{
+					rectangle(layer, 0, 8, gray),
+					rectangle(layer, 8, 16, gray),
+					{Type: &pb.DrawRequest_AutoRoll{AutoRoll: &pb.AutoRoll{Layer: layer}}},
+				}}
+				if err := tower.Draw(stream); err != nil {
+					t.Error(err)
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+	<-readers
+
+	if n := stop(); n != streams*rounds {
+		t.Errorf("%d layers sets sent, want %d", n, streams*rounds)
+	}
+	// each stream paints both halves of its layer with the same color: a
+	// layer has two colors if the changes of two streams were mixed
+	for layer := 0; layer < 4; layer++ {
+		if colors := layerColors(tower, layer); len(colors) != 1 {
+			t.Errorf("layer %d has %d colors, want 1", layer, len(colors))
+		}
+	}
+}
+
+func TestAbortedDrawStreamCommitsNothing(t *testing.T) {
+	tests := []struct {
+		name string
+		last *pb.DrawRequest // appended to the valid requests
+		err  error           // returned by the stream after the requests
+	}{
+		{name: "canceled by the client", err: context.Canceled},
+		{name: "invalid request", last: rectangle(99, 0, 16, 0xff)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tower, stop := newTestRenderer()
+			requests := []*pb.DrawRequest{rectangle(1, 0, 16, 0xff)}
+			if tt.last != nil {
+				requests = append(requests, tt.last)
+			}
+			stream := &fakeDrawStream{requests: requests, err: tt.err}
+			if err := tower.Draw(stream); err == nil {
+				t.Fatal("Draw succeeded")
+			}
+			if n := stop(); n != 0 {
+				t.Errorf("%d layers sets sent, want none", n)
+			}
+			if stream.closed {
+				t.Error("stream closed with a response")
+			}
+			layers, active := tower.committedLayers()
+			if active[1] || !layers[1].image.Bounds().Empty() {
+				t.Errorf("layer 1 modified: active %v, bounds %v",
+					active[1], layers[1].image.Bounds())
+			}
+		})
+	}
+}
+
+func TestSessionCopiesTheImageOnWrite(t *testing.T) {
+	tower, stop := newTestRenderer()
+	defer stop()
+	if err := tower.Draw(&fakeDrawStream{requests: []*pb.DrawRequest{rectangle(0, 0, 16, 1)}}); err != nil {
+		t.Fatal(err)
+	}
+	committed, _ := tower.committedLayers()
+
+	session := tower.newSession(context.Background())
+	rect := rectangle(0, 0, 16, 2).Type.(*pb.DrawRequest_DrawRectangle).DrawRectangle
+	if err := session.drawRectangle(rect); err != nil {
+		t.Fatal(err)
+	}
+	if c := committed[0].image.RGBAAt(0, 0).R; c != 1 {
+		t.Errorf("committed image modified by a session: red = %d", c)
+	}
+	if session.layers[0].image == committed[0].image {
+		t.Error("session shares the committed image")
+	}
+	if b := session.layers[0].image.Bounds(); b != image.Rect(0, 0, 16, 8) {
+		t.Errorf("session image bounds = %v", b)
+	}
+}
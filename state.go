@@ -0,0 +1,77 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"bytes"
+	"image/png"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	api "github.com/telecom-tower/grpc-renderer/api/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetState returns the state of the display and of all its layers. The
+// images of the layers are included as PNG if Pixels is set. A PNG has no
+// offset, the position of the image in its layer is given by Min.
+func (tower *TowerRenderer) GetState(ctx context.Context, req *api.GetStateRequest) (*api.GetStateResponse, error) {
+	log.Debugf("Get state (pixels: %v)", req.Pixels)
+	layers, active := tower.committedLayers()
+
+	health, err := tower.Health()
+	res := &api.GetStateResponse{
+		Width:      uint32(tower.config.Width),
+		Height:     uint32(tower.config.Height),
+		Brightness: uint32(tower.Brightness()),
+		Layers:     make([]*api.LayerState, len(layers)),
+		Health:     api.Health(health),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	for i, l := range layers {
+		bounds := l.image.Bounds()
+		state := &api.LayerState{
+			Layer:  uint32(i),
+			Active: active[i],
+			Origin: &api.Point{X: int32(l.origin.X), Y: int32(l.origin.Y)},
+			Alpha:  uint32(l.alpha),
+			Min:    &api.Point{X: int32(bounds.Min.X), Y: int32(bounds.Min.Y)},
+			Width:  uint32(bounds.Dx()),
+			Height: uint32(bounds.Dy()),
+			Rolling: &api.Rolling{
+				Mode:       int32(l.rolling.mode),
+				Entry:      uint32(l.rolling.entry),
+				Separator:  uint32(l.rolling.separator),
+				Speed:      float32(l.rolling.speed),
+				Direction:  api.Direction(l.rolling.direction),
+				PauseMs:    uint32(l.rolling.pause / time.Millisecond),
+				LineHeight: uint32(l.rolling.lineHeight),
+			},
+		}
+		if req.Pixels && !bounds.Empty() {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, l.image); err != nil {
+				return nil, status.Errorf(codes.Internal, "layer %d: %v", i, err)
+			}
+			state.Png = buf.Bytes()
+		}
+		res.Layers[i] = state
+	}
+	return res, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+)
+
+// tracer creates the spans of the renderer. They are exported by the
+// global tracer provider (see the tracing package).
+var tracer = otel.Tracer("github.com/telecom-tower/grpc-renderer")
+
+// layersUpdate is a new set of layers sent to the loop, or a request to
+// display the current layers again if refresh is set. The context carries
+// the trace of the change, ending with the frame in which it is first
+// displayed.
+type layersUpdate struct {
+	ctx     context.Context
+	layers  layersSet
+	refresh bool
+}
+
+// endSpan records err, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
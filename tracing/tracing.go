@@ -0,0 +1,61 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing exports the traces of the renderer to an OpenTelemetry
+// collector using OTLP over gRPC.
+package tracing
+
+import (
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultEndpoint is the address of a local collector
+	DefaultEndpoint = "localhost:4317"
+	// DefaultServiceName is the name of the service in the traces
+	DefaultServiceName = "telecom-tower"
+)
+
+// Start sends the traces to the collector at endpoint (without TLS) and
+// returns a function flushing the remaining traces and stopping the
+// export.
+func Start(ctx context.Context, endpoint string, serviceName string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to create OTLP exporter")
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
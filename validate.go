@@ -0,0 +1,123 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"image"
+
+	"github.com/telecom-tower/sdk"
+	pb "github.com/telecom-tower/towerapi/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func invalidArgument(format string, a ...interface{}) error {
+	return status.Errorf(codes.InvalidArgument, format, a...)
+}
+
+func outOfRange(format string, a ...interface{}) error {
+	return status.Errorf(codes.OutOfRange, format, a...)
+}
+
+func permissionDenied(format string, a ...interface{}) error {
+	return status.Errorf(codes.PermissionDenied, format, a...)
+}
+
+func errMissing(field string) error {
+	return invalidArgument("missing %s", field)
+}
+
+func (session *drawSession) checkLayer(layer uint32) error {
+	if int(layer) >= len(session.layers) {
+		return outOfRange("layer %d out of range [0, %d)", layer, len(session.layers))
+	}
+	if !session.permissions.allowsLayer(layer) {
+		return permissionDenied("layer %d not allowed", layer)
+	}
+	return nil
+}
+
+// maxCanvasDisplays bounds the image of a layer to the area of this many
+// displays. It leaves room for long rolling texts, but a request cannot
+// make the renderer allocate gigabytes.
+const maxCanvasDisplays = 1024
+
+// maxCanvas returns the maximum size of the image of a layer, in pixels
+func (config Config) maxCanvas() int {
+	return maxCanvasDisplays * config.Width * config.Height
+}
+
+// checkCanvas returns an OutOfRange status if growing the image of the
+// layer to cover rect would make it too large
+func (session *drawSession) checkCanvas(layer uint32, rect image.Rectangle) error {
+	bounds := session.layers[layer].image.Bounds().Union(rect)
+	return session.checkCanvasSize(layer, bounds.Dx(), bounds.Dy())
+}
+
+func (session *drawSession) checkCanvasSize(layer uint32, width, height int) error {
+	max := session.config.maxCanvas()
+	if width > max || height > max || width*height > max {
+		return outOfRange("layer %d would have %dx%d pixels, more than %d",
+			layer, width, height, max)
+	}
+	return nil
+}
+
+func checkPoint(p *pb.Point, field string) error {
+	if p == nil {
+		return errMissing(field)
+	}
+	return nil
+}
+
+func checkColor(c *pb.Color, field string) error {
+	if c == nil {
+		return errMissing(field)
+	}
+	if c.Red > 0xff || c.Green > 0xff || c.Blue > 0xff || c.Alpha > 0xff {
+		return outOfRange("%s components out of range [0, 255]", field)
+	}
+	return nil
+}
+
+func checkPaintMode(mode pb.PaintMode) error {
+	if mode != pb.PaintMode_SET && mode != pb.PaintMode_OVER {
+		return invalidArgument("invalid paint mode %d", mode)
+	}
+	return nil
+}
+
+func checkRollingMode(mode int) error {
+	switch mode {
+	case sdk.RollingStop, sdk.RollingStart, sdk.RollingNext, sdk.RollingContinue:
+		return nil
+	}
+	return invalidArgument("invalid rolling mode %d", mode)
+}
+
+func checkRollingDirection(direction int) error {
+	switch direction {
+	case rollingLeft, rollingRight, rollingUp, rollingDown:
+		return nil
+	}
+	return invalidArgument("invalid rolling direction %d", direction)
+}
+
+// requestError adds the index of the offending request to the status of
+// err
+func requestError(index int, err error) error {
+	st := status.Convert(err)
+	return status.Errorf(st.Code(), "request %d: %s", index, st.Message())
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/telecom-tower/sdk"
+	pb "github.com/telecom-tower/towerapi/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// drawRectangle returns a request filling a rectangle of a layer with
+// white
+func drawRectangle(layer uint32, min, max *pb.Point, mode pb.PaintMode) *pb.DrawRequest {
+	return &pb.DrawRequest{Type: &pb.DrawRequest_DrawRectangle{
+		DrawRectangle: &pb.DrawRectangle{
+			Layer:     layer,
+			Min:       min,
+			Max:       max,
+			Color:     &pb.Color{Red: 0xff, Green: 0xff, Blue: 0xff, Alpha: 0xff},
+			PaintMode: mode,
+		},
+	}}
+}
+
+func autoRoll(layer uint32, mode int32, entry uint32) *pb.DrawRequest {
+	return &pb.DrawRequest{Type: &pb.DrawRequest_AutoRoll{
+		AutoRoll: &pb.AutoRoll{Layer: layer, Mode: mode, Entry: entry},
+	}}
+}
+
+func TestDrawValidation(t *testing.T) {
+	// the display of newTestRenderer has 16x8 pixels and 4 layers
+	max := int32(maxCanvasDisplays * 16 * 8)
+	origin := &pb.Point{X: 0, Y: 0}
+	tests := []struct {
+		name     string
+		requests []*pb.DrawRequest
+		code     codes.Code
+		index    int // index of the offending request
+	}{
+		{
+			name:     "valid requests",
+			requests: []*pb.DrawRequest{rectangle(0, 0, 4, 0x10), autoRoll(0, sdk.RollingStart, 16)},
+			code:     codes.OK,
+		},
+		{
+			name:     "layer out of range",
+			requests: []*pb.DrawRequest{rectangle(4, 0, 4, 0x10)},
+			code:     codes.OutOfRange,
+		},
+		{
+			name:     "second request invalid",
+			requests: []*pb.DrawRequest{rectangle(0, 0, 4, 0x10), rectangle(4, 0, 4, 0x10)},
+			code:     codes.OutOfRange,
+			index:    1,
+		},
+		{
+			name:     "canvas too wide",
+			requests: []*pb.DrawRequest{drawRectangle(0, origin, &pb.Point{X: max + 1, Y: 1}, pb.PaintMode_SET)},
+			code:     codes.OutOfRange,
+		},
+		{
+			name:     "canvas too large",
+			requests: []*pb.DrawRequest{drawRectangle(0, origin, &pb.Point{X: 1024, Y: 129}, pb.PaintMode_SET)},
+			code:     codes.OutOfRange,
+		},
+		{
+			name:     "missing point",
+			requests: []*pb.DrawRequest{drawRectangle(0, nil, &pb.Point{X: 1, Y: 1}, pb.PaintMode_SET)},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "bad paint mode",
+			requests: []*pb.DrawRequest{drawRectangle(0, origin, &pb.Point{X: 1, Y: 1}, pb.PaintMode(2))},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "bad rolling mode",
+			requests: []*pb.DrawRequest{autoRoll(0, sdk.RollingContinue+1, 0)},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "rolling entry too large",
+			requests: []*pb.DrawRequest{autoRoll(0, sdk.RollingStart, uint32(max))},
+			code:     codes.OutOfRange,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tower, stop := newTestRenderer()
+			defer stop()
+			err := tower.Draw(&fakeDrawStream{requests: tt.requests})
+			if got := status.Code(err); got != tt.code {
+				t.Fatalf("Draw() = %v, want %v", err, tt.code)
+			}
+			if tt.code == codes.OK {
+				return
+			}
+			prefix := fmt.Sprintf("request %d: ", tt.index)
+			if msg := status.Convert(err).Message(); !strings.HasPrefix(msg, prefix) {
+				t.Errorf("message %q does not start with %q", msg, prefix)
+			}
+			if colors := layerColors(tower, 0); len(colors) != 0 {
+				t.Errorf("invalid stream drew %v", colors)
+			}
+		})
+	}
+}